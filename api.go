@@ -2,19 +2,40 @@ package goxfree
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
+	"os"
 	"strings"
+	"time"
 )
 
+// defaultApiTimeout caps requests whose context carries no deadline.
+const defaultApiTimeout = 5 * time.Second
+
 type api struct {
 	client *http.Client
 }
 
+func newHttpTcpClient(address string) *api {
+	dialer := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "tcp", address)
+	}
+	return &api{
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext: dialer,
+			},
+		},
+	}
+}
+
 func (a *api) url(path string, query url.Values) string {
 	var q string
 	if query != nil {
@@ -24,9 +45,15 @@ func (a *api) url(path string, query url.Values) string {
 	return fmt.Sprintf("http://unix/%s?%s", path, q)
 }
 func (a *api) do(req *http.Request) ([]byte, error) {
+	// requests without a deadline keep the historical 5s limit
+	if _, ok := req.Context().Deadline(); !ok {
+		ctx, cancel := context.WithTimeout(req.Context(), defaultApiTimeout)
+		defer cancel()
+		req = req.WithContext(ctx)
+	}
 	resp, err := a.client.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, wrapDialError(err)
 	}
 	defer resp.Body.Close()
 	body, err := io.ReadAll(resp.Body)
@@ -40,57 +67,68 @@ func (a *api) do(req *http.Request) ([]byte, error) {
 		Message string `json:"message"`
 	}
 	json.Unmarshal(body, &data)
-	if data.Message != "" {
-		return nil, errors.New(data.Message)
+	return nil, &APIError{
+		Endpoint:   req.URL.Path,
+		Method:     req.Method,
+		StatusCode: resp.StatusCode,
+		Message:    data.Message,
+	}
+}
+
+// wrapDialError marks failures to reach the server with ErrNotRunning.
+func wrapDialError(err error) error {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" || errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %w", ErrNotRunning, err)
 	}
-	return nil, fmt.Errorf("status code: %d", resp.StatusCode)
+	return err
 }
-func (a *api) get(path string, query url.Values) ([]byte, error) {
-	req, err := http.NewRequest(http.MethodGet, a.url(path, query), nil)
+func (a *api) get(ctx context.Context, path string, query url.Values) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.url(path, query), nil)
 	if err != nil {
 		return nil, err
 	}
 	return a.do(req)
 }
-func (a *api) post(path string, query url.Values, data interface{}) ([]byte, error) {
+func (a *api) post(ctx context.Context, path string, query url.Values, data interface{}) ([]byte, error) {
 	dataBody, err := json.Marshal(data)
 	if err != nil {
 		return nil, err
 	}
-	req, err := http.NewRequest(http.MethodPost, a.url(path, query), bytes.NewReader(dataBody))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url(path, query), bytes.NewReader(dataBody))
 	if err != nil {
 		return nil, err
 	}
 	return a.do(req)
 }
-func (a *api) put(path string, query url.Values, param interface{}) ([]byte, error) {
+func (a *api) put(ctx context.Context, path string, query url.Values, param interface{}) ([]byte, error) {
 	paramBody, err := json.Marshal(param)
 	if err != nil {
 		return nil, err
 	}
-	req, err := http.NewRequest(http.MethodPut, a.url(path, query), bytes.NewReader(paramBody))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, a.url(path, query), bytes.NewReader(paramBody))
 	if err != nil {
 		return nil, err
 	}
 	return a.do(req)
 }
-func (a *api) patch(path string, query url.Values, data interface{}) ([]byte, error) {
+func (a *api) patch(ctx context.Context, path string, query url.Values, data interface{}) ([]byte, error) {
 	dataBody, err := json.Marshal(data)
 	if err != nil {
 		return nil, err
 	}
-	req, err := http.NewRequest(http.MethodPatch, a.url(path, query), bytes.NewReader(dataBody))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPatch, a.url(path, query), bytes.NewReader(dataBody))
 	if err != nil {
 		return nil, err
 	}
 	return a.do(req)
 }
-func (a *api) delete(path string, query url.Values, data interface{}) ([]byte, error) {
+func (a *api) delete(ctx context.Context, path string, query url.Values, data interface{}) ([]byte, error) {
 	dataBody, err := json.Marshal(data)
 	if err != nil {
 		return nil, err
 	}
-	req, err := http.NewRequest(http.MethodDelete, a.url(path, query), bytes.NewReader(dataBody))
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, a.url(path, query), bytes.NewReader(dataBody))
 	if err != nil {
 		return nil, err
 	}
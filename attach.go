@@ -0,0 +1,63 @@
+package goxfree
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// DetectMode connects to an already running xfree server, on the unix
+// address first and the tcp address second, and reports its mode.
+func DetectMode(ctx context.Context, option Option) (Mode, error) {
+	_, _, mode, err := attachServer(ctx, option)
+	return mode, err
+}
+
+func attachServer(ctx context.Context, option Option) (*api, *ws, Mode, error) {
+	type candidate struct {
+		api *api
+		ws  *ws
+	}
+	var candidates []candidate
+	if address := option.GetServerUnixAddress(); address != "" {
+		candidates = append(candidates, candidate{newHttpUnixClient(address), newWsUnixDialer(address)})
+	}
+	if address := option.GetServerTcpAddress(); address != "" {
+		candidates = append(candidates, candidate{newHttpTcpClient(address), newWsTcpDialer(address)})
+	}
+	if len(candidates) == 0 {
+		return nil, nil, "", fmt.Errorf("%w: no server address", ErrNotRunning)
+	}
+	var errs []error
+	for _, c := range candidates {
+		if _, err := c.api.get(ctx, "/test", nil); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		mode, err := detectMode(ctx, c.api)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		return c.api, c.ws, mode, nil
+	}
+	return nil, nil, "", errors.Join(errs...)
+}
+
+// the manager store is a superset of the core store
+func detectMode(ctx context.Context, a *api) (Mode, error) {
+	body, err := a.get(ctx, "/store", nil)
+	if err != nil {
+		return "", err
+	}
+	var data map[string]json.RawMessage
+	if err := json.Unmarshal(body, &data); err != nil {
+		return "", err
+	}
+	for _, key := range []string{"subs", "currentMode", "currentChain"} {
+		if _, ok := data[key]; ok {
+			return MODE_MANAGER, nil
+		}
+	}
+	return MODE_CORE, nil
+}
@@ -2,13 +2,17 @@ package goxfree
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"log"
+	"os"
 	"os/exec"
-	"path"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 )
 
@@ -18,17 +22,31 @@ type (
 
 		option Option
 
-		mode    Mode
-		cmdPath string
-		cmd     *exec.Cmd
-		cmdPgid int
+		mode     Mode
+		cmdPath  string
+		cmd      *exec.Cmd
+		cmdPgid  int
+		cmdDone  chan struct{}
+		cmdStart time.Time
+		running  bool
+		onExit   func(ProcessExit)
+		logs     *ProcessLogs
+		lock     *instanceLock
 	}
 	checker struct {
 		mu        sync.Mutex
 		buffer    bytes.Buffer
 		checked   bool
+		stage     Stage
 		errChan   chan error
 		timeoutDo func()
+		onStage   func(Stage)
+	}
+	tail struct {
+		*lineWriter
+		mu    sync.Mutex
+		lines []string
+		size  int
 	}
 )
 
@@ -53,38 +71,57 @@ func newClientManager(option Option) *client {
 func (c *client) checkPermission() error {
 	permission, err := c.getPermission()
 	if err != nil {
-		return err
+		return fmt.Errorf("%w: %w", ErrPermissionDenied, err)
 	}
 	if !permission {
 		if err := c.setPermission(); err != nil {
-			return err
+			return fmt.Errorf("%w: %w", ErrPermissionDenied, err)
 		}
 	}
 	return nil
 }
 
 func (c *client) init() {
-	c.cmdPath = path.Join(
-		c.option.GetDir(),
-		cmdNames[fmt.Sprintf(
-			"%s-%s",
-			c.option.GetPlatform(), c.option.GetArch(),
-		)],
-	)
+	c.logs = newProcessLogs(c.option)
+	c.cmdPath = c.option.GetCmdPath()
 }
 
-func (c *client) Run() error {
+func (c *client) Run(ctx context.Context) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	if c.cmd != nil {
-		return errors.New("runed")
+		return &AlreadyRunningError{
+			PID:     c.cmd.Process.Pid,
+			Address: c.option.GetServerUnixAddress(),
+		}
 	}
-
-	if err := c.checkPermission(); err != nil {
+	if _, err := os.Stat(c.cmdPath); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: %s", ErrBinaryMissing, c.cmdPath)
+		}
 		return err
 	}
 
+	if c.lock == nil {
+		lock, err := acquireInstanceLock(c.option)
+		if err != nil {
+			return err
+		}
+		c.lock = lock
+		defer func() {
+			if !c.running {
+				c.releaseLock()
+			}
+		}()
+	}
+
+	if c.option.GetCheckPermission() {
+		if err := c.checkPermission(); err != nil {
+			return err
+		}
+	}
+
 	// build args
 	var args []string
 	switch c.mode {
@@ -125,34 +162,153 @@ func (c *client) Run() error {
 	// new checker
 	checker := newChecker(func() {
 		c.quit()
-	})
-	checkerListener := checker.getListener()
+	}, c.stage)
+	checkerListener := checker.getListener(c.option.GetStartTimeout())
 
 	// cmd
 	// log.Println("client command", c.cmdPath, args)
+	if c.option.GetReapOrphans() {
+		if err := c.reapOrphans(); err != nil {
+			log.Println("reap stale xfree failed:", err)
+		}
+	}
+
+	if err := c.checkSocket(); err != nil {
+		return err
+	}
+
+	c.stage(STAGE_SPAWN)
+	stderr := newTail(20)
+	output := newTail(20)
 	c.cmd = exec.Command(c.cmdPath, args...)
-	c.cmd.Stdout = checker
-	c.cmd.Stderr = checker
+	if env := c.option.GetCmdEnv(); len(env) > 0 {
+		c.cmd.Env = append(os.Environ(), env...)
+	}
+	c.cmd.Stdout = io.MultiWriter(checker, output, c.logs.writer("stdout"))
+	c.cmd.Stderr = io.MultiWriter(checker, output, stderr, c.logs.writer("stderr"))
+	c.setSysProcAttr(c.cmd)
 
 	if err := c.cmd.Start(); err != nil {
+		c.cmd = nil
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			return fmt.Errorf("%w: %w", ErrBinaryMissing, err)
+		case errors.Is(err, os.ErrPermission):
+			return fmt.Errorf("%w: %w", ErrPermissionDenied, err)
+		}
 		return err
 	}
 	c.cmdPgid = c.cmd.Process.Pid
+	c.cmdDone = make(chan struct{})
+	c.cmdStart = time.Now()
+	go c.wait(c.cmd, c.cmdDone, stderr, output)
+
+	if err := checkerListener(ctx); err != nil {
+		// a core reporting an error may keep running and hold the socket
+		c.quit()
+		if c.exited() {
+			c.cmd = nil
+			c.cmdPgid = 0
+			c.cmdDone = nil
+		}
+		return err
+	}
+	c.running = true
+	return nil
+}
+
+func (c *client) wait(cmd *exec.Cmd, done chan struct{}, stderr, output *tail) {
+	_ = cmd.Wait()
+	// quit waits on done while holding mu
+	close(done)
+
+	c.mu.Lock()
+	if c.cmd != cmd {
+		c.mu.Unlock()
+		return
+	}
+	running := c.running
+	c.cmd = nil
+	c.cmdPgid = 0
+	c.cmdDone = nil
+	c.running = false
+	exit := ProcessExit{
+		Code:   cmd.ProcessState.ExitCode(),
+		Stderr: stderr.Lines(),
+		Output: output.Lines(),
+		Uptime: time.Since(c.cmdStart),
+	}
+	if status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		exit.Signal = status.Signal()
+	}
+	onExit := c.onExit
+	c.mu.Unlock()
 
-	return checkerListener()
+	if running && onExit != nil {
+		onExit(exit)
+	}
 }
 
 func (c *client) Quit() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	c.running = false
 	c.quit()
+	if c.exited() {
+		c.cmd = nil
+		c.cmdPgid = 0
+		c.cmdDone = nil
+	}
+	c.releaseLock()
+	c.logs.close()
 	return nil
 }
 
-func newChecker(timeoutDo func()) *checker {
+func (c *client) releaseLock() {
+	if c.lock != nil {
+		c.lock.release()
+		c.lock = nil
+	}
+}
+
+// waitExit reports whether the process exited within d.
+func (c *client) waitExit(d time.Duration) bool {
+	if c.cmdDone == nil {
+		return true
+	}
+	// a closed done must win over an expired timer
+	select {
+	case <-c.cmdDone:
+		return true
+	default:
+	}
+	if d <= 0 {
+		return false
+	}
+	select {
+	case <-c.cmdDone:
+		return true
+	case <-time.After(d):
+		return false
+	}
+}
+
+func (c *client) exited() bool {
+	return c.waitExit(0)
+}
+
+func (c *client) stage(stage Stage) {
+	if fn := c.option.GetOnStage(); fn != nil {
+		fn(stage)
+	}
+}
+
+func newChecker(timeoutDo func(), onStage func(Stage)) *checker {
 	return &checker{
+		stage:     STAGE_SPAWN,
 		errChan:   make(chan error, 1),
 		timeoutDo: timeoutDo,
+		onStage:   onStage,
 	}
 }
 
@@ -178,27 +334,73 @@ func (c *checker) Write(p []byte) (n int, err error) {
 				c.errChan <- nil
 				c.checked = true
 			case strings.HasPrefix(trimmed, "CMD:ERROR:"):
-				c.errChan <- errors.New(strings.TrimPrefix(trimmed, "CMD:ERROR:"))
+				c.errChan <- &StartupError{
+					Stage: c.stage,
+					Err:   errors.New(strings.TrimPrefix(trimmed, "CMD:ERROR:")),
+				}
 				c.checked = true
+			case strings.HasPrefix(trimmed, "CMD:PROGRESS:"):
+				c.stage = Stage(strings.TrimPrefix(trimmed, "CMD:PROGRESS:"))
+				if c.onStage != nil {
+					c.onStage(c.stage)
+				}
 			}
 		}
 	}
 	return
 }
 
-func (c *checker) getListener() func() error {
-	return func() error {
-		timeout := time.After(20 * time.Second)
+func (c *checker) getStage() Stage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stage
+}
+
+func (c *checker) getListener(d time.Duration) func(context.Context) error {
+	return func(ctx context.Context) error {
+		timeout := time.After(d)
 		for {
 			select {
 			case err := <-c.errChan:
 				return err
+			case <-ctx.Done():
+				if c.timeoutDo != nil {
+					c.timeoutDo()
+				}
+				return ctx.Err()
 			case <-timeout:
 				if c.timeoutDo != nil {
 					c.timeoutDo()
 				}
-				return errors.New("timeout")
+				return &StartupError{
+					Stage:   c.getStage(),
+					Timeout: d,
+					Err:     ErrStartupTimeout,
+				}
 			}
 		}
 	}
 }
+
+func newTail(size int) *tail {
+	t := &tail{
+		size: size,
+	}
+	t.lineWriter = newLineWriter(t.add)
+	return t
+}
+
+func (t *tail) add(line string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lines = append(t.lines, line)
+	if len(t.lines) > t.size {
+		t.lines = t.lines[len(t.lines)-t.size:]
+	}
+}
+
+func (t *tail) Lines() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string(nil), t.lines...)
+}
@@ -0,0 +1,247 @@
+package goxfree
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	CONNECTION_OPENED  ConnectionEventType = "OPENED"
+	CONNECTION_UPDATED ConnectionEventType = "UPDATED"
+	CONNECTION_CLOSED  ConnectionEventType = "CLOSED"
+)
+
+var defaultConnectionRetention = 5 * time.Minute
+
+type (
+	ConnectionEventType string
+	// ConnectionEvent is a change between two Connections snapshots.
+	// Deltas and rates are relative to the previous snapshot and are zero for
+	// CONNECTION_CLOSED, which carries the last seen Connection.
+	ConnectionEvent struct {
+		Type          ConnectionEventType
+		Time          time.Time
+		Connection    Connection
+		UploadDelta   int
+		DownloadDelta int
+		UploadRate    float64 // bytes per second
+		DownloadRate  float64 // bytes per second
+	}
+	// ClosedConnection keeps the final totals of a finished connection.
+	ClosedConnection struct {
+		Connection
+		Closed time.Time `json:"closed"`
+	}
+	// ConnectionFilter selects connections, every non-empty field must match.
+	// Matching ignores case.
+	ConnectionFilter struct {
+		Host    string // metadata host, sniffed host or destination ip
+		Rule    string // rule type or rule payload
+		Process string // process name or path
+		Chain   string // any element of the chain
+	}
+	// ConnectionTracker diffs the connections stream by Connection.ID.
+	ConnectionTracker struct {
+		mu        sync.Mutex
+		sub       *Subscription
+		fn        func(ConnectionEvent)
+		retention time.Duration
+		last      time.Time
+		active    map[string]Connection
+		order     []string // ids of active in snapshot order
+		closed    []ClosedConnection
+	}
+)
+
+// NewConnectionTracker tracks the connections of c until ctx ends or Close is
+// called, fn receives every event and may be nil. Closed connections are kept
+// for retention, <= 0 uses 5 minutes.
+func NewConnectionTracker(ctx context.Context, c Controller, retention time.Duration, fn func(ConnectionEvent)) *ConnectionTracker {
+	if retention <= 0 {
+		retention = defaultConnectionRetention
+	}
+	t := &ConnectionTracker{
+		fn:        fn,
+		retention: retention,
+		active:    make(map[string]Connection),
+	}
+	t.sub = c.ListenConnectionsContext(ctx, func(data Connections) {
+		t.update(time.Now(), data.Connections)
+	})
+	return t
+}
+
+func (t *ConnectionTracker) update(now time.Time, conns []Connection) {
+	t.mu.Lock()
+	var elapsed float64
+	if !t.last.IsZero() {
+		elapsed = now.Sub(t.last).Seconds()
+	}
+	t.last = now
+
+	var events []ConnectionEvent
+	active := make(map[string]Connection, len(conns))
+	order := make([]string, 0, len(conns))
+	for _, conn := range conns {
+		active[conn.ID] = conn
+		order = append(order, conn.ID)
+		prev, ok := t.active[conn.ID]
+		if !ok {
+			events = append(events, ConnectionEvent{
+				Type:       CONNECTION_OPENED,
+				Time:       now,
+				Connection: conn,
+			})
+			continue
+		}
+		up, down := conn.Upload-prev.Upload, conn.Download-prev.Download
+		if up == 0 && down == 0 {
+			continue
+		}
+		e := ConnectionEvent{
+			Type:          CONNECTION_UPDATED,
+			Time:          now,
+			Connection:    conn,
+			UploadDelta:   up,
+			DownloadDelta: down,
+		}
+		if elapsed > 0 {
+			e.UploadRate = float64(up) / elapsed
+			e.DownloadRate = float64(down) / elapsed
+		}
+		events = append(events, e)
+	}
+	for _, id := range t.order {
+		if _, ok := active[id]; ok {
+			continue
+		}
+		conn := t.active[id]
+		t.closed = append(t.closed, ClosedConnection{
+			Connection: conn,
+			Closed:     now,
+		})
+		events = append(events, ConnectionEvent{
+			Type:       CONNECTION_CLOSED,
+			Time:       now,
+			Connection: conn,
+		})
+	}
+	t.active = active
+	t.order = order
+	t.prune(now)
+	fn := t.fn
+	t.mu.Unlock()
+
+	if fn != nil {
+		for _, e := range events {
+			fn(e)
+		}
+	}
+}
+
+func (t *ConnectionTracker) prune(now time.Time) {
+	i := 0
+	for i < len(t.closed) && now.Sub(t.closed[i].Closed) > t.retention {
+		i++
+	}
+	if i > 0 {
+		t.closed = append(t.closed[:0], t.closed[i:]...)
+	}
+}
+
+// Active returns the connections of the latest snapshot.
+func (t *ConnectionTracker) Active() []Connection {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	conns := make([]Connection, 0, len(t.order))
+	for _, id := range t.order {
+		conns = append(conns, t.active[id])
+	}
+	return conns
+}
+
+// Closed returns the connections closed within the retention window, oldest
+// first.
+func (t *ConnectionTracker) Closed() []ClosedConnection {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.prune(time.Now())
+	return append([]ClosedConnection(nil), t.closed...)
+}
+
+// Close stops tracking, the collected data stays readable.
+func (t *ConnectionTracker) Close() {
+	t.sub.Close()
+}
+
+// Done is closed when the tracker stopped receiving snapshots.
+func (t *ConnectionTracker) Done() <-chan struct{} {
+	return t.sub.Done()
+}
+
+func (f ConnectionFilter) match(conn Connection) bool {
+	m := conn.Metadata
+	return matchAny(f.Host, m.Host, m.SniffHost, m.DestinationIP) &&
+		matchAny(f.Rule, conn.Rule, conn.RulePayload) &&
+		matchAny(f.Process, m.Process, m.ProcessPath) &&
+		matchAny(f.Chain, conn.Chains...)
+}
+
+func matchAny(want string, values ...string) bool {
+	if want == "" {
+		return true
+	}
+	return slices.ContainsFunc(values, func(v string) bool {
+		return strings.EqualFold(v, want)
+	})
+}
+
+// CloseConnection drops the connection with id through the external
+// controller.
+func (c *controller[S]) CloseConnection(id string) error {
+	return c.CloseConnectionContext(context.Background(), id)
+}
+func (c *controller[S]) CloseConnectionContext(ctx context.Context, id string) error {
+	return c.external.CloseConnection(ctx, id)
+}
+
+// CloseAllConnections drops every connection through the external controller.
+func (c *controller[S]) CloseAllConnections() error {
+	return c.CloseAllConnectionsContext(context.Background())
+}
+func (c *controller[S]) CloseAllConnectionsContext(ctx context.Context) error {
+	return c.external.CloseAllConnections(ctx)
+}
+
+// CloseConnections drops the connections matching filter and returns how
+// many were closed. An empty filter matches every connection.
+func (c *controller[S]) CloseConnections(filter ConnectionFilter) (int, error) {
+	return c.CloseConnectionsContext(context.Background(), filter)
+}
+func (c *controller[S]) CloseConnectionsContext(ctx context.Context, filter ConnectionFilter) (int, error) {
+	data, err := c.external.GetConnections(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var closed int
+	for _, conn := range data.Connections {
+		if !filter.match(conn) {
+			continue
+		}
+		if err := c.CloseConnectionContext(ctx, conn.ID); err != nil {
+			var apiErr *APIError
+			// already gone between listing and closing
+			if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+				continue
+			}
+			return closed, err
+		}
+		closed++
+	}
+	return closed, nil
+}
@@ -0,0 +1,461 @@
+package goxfree
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/netip"
+	"net/url"
+	"sync"
+	"time"
+)
+
+var (
+	_ Controller = (*Core)(nil)
+	_ Controller = (*Manager)(nil)
+)
+
+type (
+	Store interface {
+		CoreStore | ManagerStore
+	}
+
+	// Controller is the surface shared by Core and Manager.
+	//
+	// The ...Context request methods fail with an error matching ctx.Err()
+	// as soon as ctx is done. A ctx without a deadline, a cancel-only one
+	// included, is still capped at 5s per request, so give ctx a deadline
+	// for longer calls. Subscriptions and RunContext/QuitContext are not
+	// capped.
+	Controller interface {
+		Mode() Mode
+		Run() error
+		RunContext(ctx context.Context) error
+		Quit() error
+		QuitContext(ctx context.Context) error
+		Done() <-chan struct{}
+		Err() error
+		Attached() bool
+		Logs() *ProcessLogs
+		ExternalController() *ExternalController
+
+		TestClient() error
+		TestClientContext(ctx context.Context) error
+		GetStatus() (Status, error)
+		GetStatusContext(ctx context.Context) (Status, error)
+		GetNetMode() (NetMode, error)
+		GetNetModeContext(ctx context.Context) (NetMode, error)
+		GetProxyMode() (ProxyMode, error)
+		GetProxyModeContext(ctx context.Context) (ProxyMode, error)
+		GetDelay(name string) (int, error)
+		GetDelayContext(ctx context.Context, name string) (int, error)
+		GetAllDelay() (map[string]int, error)
+		GetAllDelayContext(ctx context.Context) (map[string]int, error)
+
+		Open() error
+		OpenContext(ctx context.Context) error
+		Close() error
+		CloseContext(ctx context.Context) error
+		ChangeNetMode(mode NetMode) error
+		ChangeNetModeContext(ctx context.Context, mode NetMode) error
+		ChangeProxyMode(mode ProxyMode) error
+		ChangeProxyModeContext(ctx context.Context, mode ProxyMode) error
+		ChangeNodeAuto() error
+		ChangeNodeAutoContext(ctx context.Context) error
+		TestDelay(name string) (int, error)
+		TestDelayContext(ctx context.Context, name string) (int, error)
+		TestAllDelay(name string) (map[string]int, error)
+		TestAllDelayContext(ctx context.Context, name string) (map[string]int, error)
+
+		ListenMemery(fn func(Memery)) *Subscription
+		ListenMemeryContext(ctx context.Context, fn func(Memery)) *Subscription
+		ListenTraffic(fn func(Traffic)) *Subscription
+		ListenTrafficContext(ctx context.Context, fn func(Traffic)) *Subscription
+		ListenConnections(fn func(Connections)) *Subscription
+		ListenConnectionsContext(ctx context.Context, fn func(Connections)) *Subscription
+		ListenDelay(fn func(map[string]int)) *Subscription
+		ListenDelayContext(ctx context.Context, fn func(map[string]int)) *Subscription
+		Events(ctx context.Context) <-chan Event
+		ListenLogs(level LogLevel, fn func(LogEntry)) *Subscription
+		ListenLogsContext(ctx context.Context, level LogLevel, fn func(LogEntry)) *Subscription
+		ChangeLogLevel(level LogLevel) error
+		ChangeLogLevelContext(ctx context.Context, level LogLevel) error
+		GetRules() ([]Rule, error)
+		GetRulesContext(ctx context.Context) ([]Rule, error)
+		ExplainRoute(target string) (RouteExplanation, error)
+		ExplainRouteContext(ctx context.Context, target string) (RouteExplanation, error)
+		ExplainResolvedRoute(host string, addr netip.Addr) (RouteExplanation, error)
+		ExplainResolvedRouteContext(ctx context.Context, host string, addr netip.Addr) (RouteExplanation, error)
+		ResolveDNS(ctx context.Context, name, qtype string) (DNSResult, error)
+		UpdateRuntimeConfig(config RuntimeConfig) error
+		UpdateRuntimeConfigContext(ctx context.Context, config RuntimeConfig) error
+		Option() Option
+
+		CloseConnection(id string) error
+		CloseConnectionContext(ctx context.Context, id string) error
+		CloseAllConnections() error
+		CloseAllConnectionsContext(ctx context.Context) error
+		CloseConnections(filter ConnectionFilter) (int, error)
+		CloseConnectionsContext(ctx context.Context, filter ConnectionFilter) (int, error)
+	}
+
+	// controller implements everything Core and Manager have in common,
+	// S is the store type served by the binary in that mode.
+	controller[S Store] struct {
+		mode       Mode
+		client     *client
+		api        *api
+		ws         *ws
+		external   *ExternalController
+		supervisor *supervisor
+		replay     *replay
+		subs       *subscriptions
+		events     *eventHub
+
+		runtimeUpdate sync.Mutex // orders runtime updates, held over the PATCH
+		runtimeMu     sync.Mutex
+		runtime       map[string]interface{} // merged runtime config patches
+		runtimeOption Option                 // option with runtime, set with it
+	}
+)
+
+func newController[S Store](client *client) *controller[S] {
+	c := &controller[S]{
+		mode:   client.mode,
+		client: client,
+		api:    newHttpUnixClient(client.option.GetServerUnixAddress()),
+		ws:     newWsUnixDialer(client.option.GetServerUnixAddress()),
+		replay: newReplay(),
+		subs:   newSubscriptions(),
+		events: newEventHub(),
+
+		external: newExternalController(client.option.GetExternalControllerPort()),
+	}
+	c.supervisor = newSupervisor(client, c.start, c.replay.run)
+	c.supervisor.notify = c.events.emit
+	return c
+}
+
+func (c *controller[S]) Mode() Mode {
+	return c.mode
+}
+
+func (c *controller[S]) Run() error {
+	return c.RunContext(context.Background())
+}
+func (c *controller[S]) RunContext(ctx context.Context) error {
+	if c.client.option.GetAttach() {
+		return c.attach(ctx)
+	}
+	if err := c.start(ctx); err != nil {
+		return err
+	}
+	c.supervisor.watch()
+	c.events.emit(Event{Type: EVENT_STARTED})
+	return nil
+}
+
+func (c *controller[S]) attach(ctx context.Context) error {
+	api, ws, mode, err := attachServer(ctx, c.client.option)
+	if err != nil {
+		return err
+	}
+	if mode != c.mode {
+		return &ModeMismatchError{
+			Want: c.mode,
+			Got:  mode,
+		}
+	}
+	c.api = api
+	c.ws = ws
+	c.supervisor.watch()
+	c.supervisor.probe(c.client.option.GetReadyInterval(), c.TestClientContext)
+	c.events.emit(Event{Type: EVENT_STARTED})
+	return nil
+}
+
+func (c *controller[S]) start(ctx context.Context) error {
+	if err := c.client.Run(ctx); err != nil {
+		return err
+	}
+
+	c.client.stage(STAGE_CONNECT)
+	readyTimeout := c.client.option.GetReadyTimeout()
+	readyCtx, cancel := context.WithTimeout(ctx, readyTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(c.client.option.GetReadyInterval())
+	defer ticker.Stop()
+
+	var err error
+	for {
+		select {
+		case <-readyCtx.Done():
+			// the spawned core holds the instance lock, a retry needs it gone
+			c.client.Quit()
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err == nil {
+				err = ErrStartupTimeout
+			}
+			return &StartupError{
+				Stage:   STAGE_CONNECT,
+				Timeout: readyTimeout,
+				Err:     err,
+			}
+		case <-ticker.C:
+			if err = c.TestClientContext(readyCtx); err == nil {
+				c.client.stage(STAGE_READY)
+				return nil
+			}
+		}
+	}
+}
+
+func (c *controller[S]) quit(ctx context.Context) error {
+	_, err := c.api.put(ctx, "/quit", nil, nil)
+	if err != nil {
+		return err
+	}
+	return err
+}
+func (c *controller[S]) Quit() error {
+	return c.QuitContext(context.Background())
+}
+func (c *controller[S]) QuitContext(ctx context.Context) error {
+	c.supervisor.stop()
+	c.subs.closeAll()
+	if c.client.option.GetAttach() {
+		return nil
+	}
+	if err := c.quit(ctx); err != nil {
+		log.Println("use api quit failed:", err)
+	}
+	if err := c.client.Quit(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Done is closed when the running xfree goes away: after Quit, after an
+// exit the supervisor does not recover from, or when an attached server
+// stopped answering /test.
+func (c *controller[S]) Done() <-chan struct{} {
+	return c.supervisor.Done()
+}
+
+// Err returns nil after Quit and an *ExitError when the process died. For an
+// attached server it is the error of the last failed /test probe, wrapping
+// ErrNotRunning when the server could not be reached.
+func (c *controller[S]) Err() error {
+	return c.supervisor.Err()
+}
+
+func (c *controller[S]) Attached() bool {
+	return c.client.option.GetAttach()
+}
+func (c *controller[S]) Logs() *ProcessLogs {
+	return c.client.logs
+}
+
+func (c *controller[S]) TestClient() error {
+	return c.TestClientContext(context.Background())
+}
+func (c *controller[S]) TestClientContext(ctx context.Context) error {
+	_, err := c.api.get(ctx, "/test", nil)
+	if err != nil {
+		return err
+	}
+	return err
+}
+func (c *controller[S]) GetStatus() (Status, error) {
+	return c.GetStatusContext(context.Background())
+}
+func (c *controller[S]) GetStatusContext(ctx context.Context) (Status, error) {
+	var data Status
+	body, err := c.api.get(ctx, "/status", nil)
+	if err != nil {
+		return data, err
+	}
+	err = json.Unmarshal(body, &data)
+	return data, err
+}
+func (c *controller[S]) GetNetMode() (NetMode, error) {
+	return c.GetNetModeContext(context.Background())
+}
+func (c *controller[S]) GetNetModeContext(ctx context.Context) (NetMode, error) {
+	var data NetMode
+	body, err := c.api.get(ctx, "/net-mode", nil)
+	if err != nil {
+		return data, err
+	}
+	err = json.Unmarshal(body, &data)
+	return data, err
+}
+func (c *controller[S]) GetProxyMode() (ProxyMode, error) {
+	return c.GetProxyModeContext(context.Background())
+}
+func (c *controller[S]) GetProxyModeContext(ctx context.Context) (ProxyMode, error) {
+	var data ProxyMode
+	body, err := c.api.get(ctx, "/proxy-mode", nil)
+	if err != nil {
+		return data, err
+	}
+	err = json.Unmarshal(body, &data)
+	return data, err
+}
+func (c *controller[S]) GetDelay(name string) (int, error) {
+	return c.GetDelayContext(context.Background(), name)
+}
+func (c *controller[S]) GetDelayContext(ctx context.Context, name string) (int, error) {
+	var data int
+	query := make(url.Values)
+	query.Set("name", name)
+	body, err := c.api.get(ctx, "/delay", query)
+	if err != nil {
+		return data, err
+	}
+	err = json.Unmarshal(body, &data)
+	return data, err
+}
+func (c *controller[S]) GetAllDelay() (map[string]int, error) {
+	return c.GetAllDelayContext(context.Background())
+}
+func (c *controller[S]) GetAllDelayContext(ctx context.Context) (map[string]int, error) {
+	var data map[string]int
+	body, err := c.api.get(ctx, "/all-delay", nil)
+	if err != nil {
+		return data, err
+	}
+	err = json.Unmarshal(body, &data)
+	return data, err
+}
+func (c *controller[S]) GetStore() (S, error) {
+	return c.GetStoreContext(context.Background())
+}
+func (c *controller[S]) GetStoreContext(ctx context.Context) (S, error) {
+	var data S
+	body, err := c.api.get(ctx, "/store", nil)
+	if err != nil {
+		return data, err
+	}
+	err = json.Unmarshal(body, &data)
+	return data, err
+}
+
+func (c *controller[S]) Open() error {
+	return c.OpenContext(context.Background())
+}
+func (c *controller[S]) OpenContext(ctx context.Context) error {
+	_, err := c.api.put(ctx, "/open", nil, nil)
+	if err == nil {
+		c.replay.set("status", func(ctx context.Context) error {
+			return c.OpenContext(ctx)
+		})
+	}
+	return err
+}
+func (c *controller[S]) Close() error {
+	return c.CloseContext(context.Background())
+}
+func (c *controller[S]) CloseContext(ctx context.Context) error {
+	_, err := c.api.put(ctx, "/close", nil, nil)
+	if err == nil {
+		c.replay.set("status", func(ctx context.Context) error {
+			return c.CloseContext(ctx)
+		})
+	}
+	return err
+}
+func (c *controller[S]) ChangeNetMode(mode NetMode) error {
+	return c.ChangeNetModeContext(context.Background(), mode)
+}
+func (c *controller[S]) ChangeNetModeContext(ctx context.Context, mode NetMode) error {
+	_, err := c.api.put(ctx, "/change-net-mode", nil, mode)
+	if err == nil {
+		c.replay.set("net-mode", func(ctx context.Context) error {
+			return c.ChangeNetModeContext(ctx, mode)
+		})
+	}
+	return err
+}
+func (c *controller[S]) ChangeProxyMode(mode ProxyMode) error {
+	return c.ChangeProxyModeContext(context.Background(), mode)
+}
+func (c *controller[S]) ChangeProxyModeContext(ctx context.Context, mode ProxyMode) error {
+	_, err := c.api.put(ctx, "/change-proxy-mode", nil, mode)
+	if err == nil {
+		c.replay.set("proxy-mode", func(ctx context.Context) error {
+			return c.ChangeProxyModeContext(ctx, mode)
+		})
+	}
+	return err
+}
+func (c *controller[S]) ChangeNodeAuto() error {
+	return c.ChangeNodeAutoContext(context.Background())
+}
+func (c *controller[S]) ChangeNodeAutoContext(ctx context.Context) error {
+	_, err := c.api.put(ctx, "/change-node-auto", nil, nil)
+	if err == nil {
+		c.replay.set("node", func(ctx context.Context) error {
+			return c.ChangeNodeAutoContext(ctx)
+		})
+	}
+	return err
+}
+func (c *controller[S]) TestDelay(name string) (int, error) {
+	return c.TestDelayContext(context.Background(), name)
+}
+func (c *controller[S]) TestDelayContext(ctx context.Context, name string) (int, error) {
+	var data int
+	body, err := c.api.put(ctx, "/test-delay", nil, name)
+	if err != nil {
+		return data, err
+	}
+	err = json.Unmarshal(body, &data)
+	return data, err
+}
+func (c *controller[S]) TestAllDelay(name string) (map[string]int, error) {
+	return c.TestAllDelayContext(context.Background(), name)
+}
+func (c *controller[S]) TestAllDelayContext(ctx context.Context, name string) (map[string]int, error) {
+	var data map[string]int
+	body, err := c.api.put(ctx, "/test-all-delay", nil, nil)
+	if err != nil {
+		return data, err
+	}
+	err = json.Unmarshal(body, &data)
+	return data, err
+}
+
+func (c *controller[S]) ListenMemery(fn func(Memery)) *Subscription {
+	return c.ListenMemeryContext(context.Background(), fn)
+}
+func (c *controller[S]) ListenMemeryContext(ctx context.Context, fn func(Memery)) *Subscription {
+	return listen(ctx, c, "/listen-memery", fn)
+}
+func (c *controller[S]) ListenTraffic(fn func(Traffic)) *Subscription {
+	return c.ListenTrafficContext(context.Background(), fn)
+}
+func (c *controller[S]) ListenTrafficContext(ctx context.Context, fn func(Traffic)) *Subscription {
+	return listen(ctx, c, "/listen-traffic", fn)
+}
+func (c *controller[S]) ListenConnections(fn func(Connections)) *Subscription {
+	return c.ListenConnectionsContext(context.Background(), fn)
+}
+func (c *controller[S]) ListenConnectionsContext(ctx context.Context, fn func(Connections)) *Subscription {
+	return listen(ctx, c, "/listen-connections", fn)
+}
+func (c *controller[S]) ListenDelay(fn func(map[string]int)) *Subscription {
+	return c.ListenDelayContext(context.Background(), fn)
+}
+func (c *controller[S]) ListenDelayContext(ctx context.Context, fn func(map[string]int)) *Subscription {
+	return listen(ctx, c, "/listen-delay", fn)
+}
+func (c *controller[S]) ListenStore(fn func(S)) *Subscription {
+	return c.ListenStoreContext(context.Background(), fn)
+}
+func (c *controller[S]) ListenStoreContext(ctx context.Context, fn func(S)) *Subscription {
+	return listen(ctx, c, "/listen-store", fn)
+}
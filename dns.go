@@ -0,0 +1,74 @@
+package goxfree
+
+import (
+	"context"
+	"log"
+	"net/netip"
+	"net/url"
+)
+
+type (
+	DNSQuestion struct {
+		Name string `json:"name"`
+		Type uint16 `json:"type"`
+	}
+	DNSAnswer struct {
+		Name string `json:"name"`
+		Type uint16 `json:"type"`
+		TTL  uint32 `json:"TTL"`
+		Data string `json:"data"`
+		// Data is an address of the fake-ip range handed out in MODE_TUN
+		FakeIP bool `json:"fakeIP"`
+	}
+	// DNSResult is the answer of the engine resolver, Status is the DNS
+	// rcode, 0 meaning success.
+	DNSResult struct {
+		Status     int           `json:"Status"`
+		Question   []DNSQuestion `json:"Question"`
+		Answer     []DNSAnswer   `json:"Answer"`
+		Authority  []DNSAnswer   `json:"Authority"`
+		Additional []DNSAnswer   `json:"Additional"`
+		// the engine answered from its fake-ip pool
+		FakeIP bool `json:"fakeIP"`
+	}
+)
+
+// ResolveDNS asks the resolver of the running engine, qtype is a record type
+// such as "A" or "AAAA", empty means "A". FakeIP is left unset when the net
+// mode can't be read.
+func (c *controller[S]) ResolveDNS(ctx context.Context, name, qtype string) (DNSResult, error) {
+	var data DNSResult
+	if qtype == "" {
+		qtype = "A"
+	}
+	query := url.Values{}
+	query.Set("name", name)
+	query.Set("type", qtype)
+	if err := c.external.getJSON(ctx, "/dns/query", query, &data); err != nil {
+		return data, err
+	}
+
+	// fake ips are only handed out in tun mode, the answer stands even when
+	// that can't be told
+	netMode, err := c.GetNetModeContext(ctx)
+	if err != nil {
+		log.Println("get net mode for fake ip failed:", err)
+		return data, nil
+	}
+	if netMode != MODE_TUN {
+		return data, nil
+	}
+	fakeRange, err := netip.ParsePrefix(c.client.option.GetFakeIPRange())
+	if err != nil {
+		log.Println("parse fake ip range failed:", err)
+		return data, nil
+	}
+	for i, answer := range data.Answer {
+		addr, err := netip.ParseAddr(answer.Data)
+		if err == nil && fakeRange.Contains(addr) {
+			data.Answer[i].FakeIP = true
+			data.FakeIP = true
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,109 @@
+package goxfree
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotRunning       = errors.New("xfree not running")
+	ErrAlreadyRunning   = errors.New("xfree already running")
+	ErrStartupTimeout   = errors.New("xfree startup timeout")
+	ErrPermissionDenied = errors.New("xfree permission denied")
+	ErrBinaryMissing    = errors.New("xfree binary missing")
+	ErrModeMismatch     = errors.New("xfree mode mismatch")
+
+	ErrSubscriptionClosed = errors.New("subscription closed")
+	ErrStreamUnavailable  = errors.New("stream unavailable")
+)
+
+// APIError is a non-2xx answer of the xfree server.
+type APIError struct {
+	Endpoint   string
+	Method     string
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("xfree api %s %s: %s", e.Method, e.Endpoint, e.Message)
+	}
+	return fmt.Sprintf("xfree api %s %s: status code: %d", e.Method, e.Endpoint, e.StatusCode)
+}
+
+// AlreadyRunningError is returned when another host owns the instance lock
+// in the data dir. It matches ErrAlreadyRunning.
+type AlreadyRunningError struct {
+	PID     int
+	Address string
+}
+
+func (e *AlreadyRunningError) Error() string {
+	return fmt.Sprintf("xfree already running, pid: %d, address: %s", e.PID, e.Address)
+}
+
+func (e *AlreadyRunningError) Is(target error) bool {
+	return target == ErrAlreadyRunning
+}
+
+// ModeMismatchError is returned when attaching to a server running in the
+// other mode. It matches ErrModeMismatch.
+type ModeMismatchError struct {
+	Want Mode
+	Got  Mode
+}
+
+func (e *ModeMismatchError) Error() string {
+	return fmt.Sprintf("xfree is running in %s mode, want %s", e.Got, e.Want)
+}
+
+func (e *ModeMismatchError) Is(target error) bool {
+	return target == ErrModeMismatch
+}
+
+// StartupError reports the startup stage that failed or stalled. A stalled
+// stage matches ErrStartupTimeout.
+type StartupError struct {
+	Stage   Stage
+	Timeout time.Duration
+	Err     error
+}
+
+func (e *StartupError) Error() string {
+	if e.Timeout > 0 {
+		return fmt.Sprintf("startup stalled at stage %s after %s: %v", e.Stage, e.Timeout, e.Err)
+	}
+	return fmt.Sprintf("startup failed at stage %s: %v", e.Stage, e.Err)
+}
+
+func (e *StartupError) Unwrap() error {
+	return e.Err
+}
+
+func (e *StartupError) Is(target error) bool {
+	return target == ErrStartupTimeout && e.Timeout > 0
+}
+
+// ExitError reports why the core process went away.
+type ExitError struct {
+	Code   int
+	Signal os.Signal
+	Output []string
+}
+
+func (e *ExitError) Error() string {
+	var msg string
+	if e.Signal != nil {
+		msg = fmt.Sprintf("xfree killed by signal %v", e.Signal)
+	} else {
+		msg = fmt.Sprintf("xfree exited with code %d", e.Code)
+	}
+	if len(e.Output) > 0 {
+		msg += ": " + strings.TrimSpace(e.Output[len(e.Output)-1])
+	}
+	return msg
+}
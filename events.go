@@ -0,0 +1,147 @@
+package goxfree
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	EVENT_MEMERY      EventType = "MEMERY"
+	EVENT_TRAFFIC     EventType = "TRAFFIC"
+	EVENT_CONNECTIONS EventType = "CONNECTIONS"
+	EVENT_DELAY       EventType = "DELAY"
+	EVENT_STORE       EventType = "STORE"
+
+	EVENT_STARTED     EventType = "STARTED"
+	EVENT_STOPPED     EventType = "STOPPED"
+	EVENT_RECONNECTED EventType = "RECONNECTED"
+)
+
+type (
+	EventType string
+	// Event is one item of the Events stream, the field matching Type is set.
+	Event struct {
+		Type        EventType
+		Time        time.Time
+		Memery      *Memery
+		Traffic     *Traffic
+		Connections *Connections
+		Delay       map[string]int
+		// CoreStore for a Core, ManagerStore for a Manager
+		Store interface{}
+		// stream path of EVENT_RECONNECTED
+		Stream string
+		// value of Err() for EVENT_STOPPED
+		Err error
+	}
+
+	eventHub struct {
+		mu        sync.Mutex
+		listeners map[int]func(Event)
+		nextID    int
+	}
+)
+
+func newEventHub() *eventHub {
+	return &eventHub{
+		listeners: make(map[int]func(Event)),
+	}
+}
+
+func (h *eventHub) add(fn func(Event)) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.nextID++
+	h.listeners[h.nextID] = fn
+	return h.nextID
+}
+
+func (h *eventHub) remove(id int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.listeners, id)
+}
+
+func (h *eventHub) emit(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	h.mu.Lock()
+	listeners := make([]func(Event), 0, len(h.listeners))
+	for _, fn := range h.listeners {
+		listeners = append(listeners, fn)
+	}
+	h.mu.Unlock()
+	for _, fn := range listeners {
+		fn(e)
+	}
+}
+
+// Events merges every stream and the lifecycle into one channel. The channel
+// is closed when ctx ends or after EVENT_STOPPED. Stream events wait for room
+// in the buffer, lifecycle events are dropped when it is full so a reader
+// that stops draining never holds up Run, restarts or other subscriptions.
+func (c *controller[S]) Events(ctx context.Context) <-chan Event {
+	ctx, cancel := context.WithCancel(ctx)
+	ch := make(chan Event, 64)
+	var (
+		mu     sync.RWMutex // write locked to close ch
+		closed bool
+	)
+	send := func(e Event) {
+		if e.Time.IsZero() {
+			e.Time = time.Now()
+		}
+		mu.RLock()
+		defer mu.RUnlock()
+		if closed {
+			return
+		}
+		select {
+		case ch <- e:
+		case <-ctx.Done():
+		}
+	}
+	notify := func(e Event) {
+		mu.RLock()
+		defer mu.RUnlock()
+		if closed {
+			return
+		}
+		select {
+		case ch <- e:
+		default:
+		}
+		if e.Type == EVENT_STOPPED {
+			cancel()
+		}
+	}
+	id := c.events.add(notify)
+
+	c.ListenMemeryContext(ctx, func(data Memery) {
+		send(Event{Type: EVENT_MEMERY, Memery: &data})
+	})
+	c.ListenTrafficContext(ctx, func(data Traffic) {
+		send(Event{Type: EVENT_TRAFFIC, Traffic: &data})
+	})
+	c.ListenConnectionsContext(ctx, func(data Connections) {
+		send(Event{Type: EVENT_CONNECTIONS, Connections: &data})
+	})
+	c.ListenDelayContext(ctx, func(data map[string]int) {
+		send(Event{Type: EVENT_DELAY, Delay: data})
+	})
+	c.ListenStoreContext(ctx, func(data S) {
+		send(Event{Type: EVENT_STORE, Store: data})
+	})
+
+	go func() {
+		<-ctx.Done()
+		c.events.remove(id)
+		mu.Lock()
+		closed = true
+		close(ch)
+		mu.Unlock()
+	}()
+	return ch
+}
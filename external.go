@@ -0,0 +1,239 @@
+package goxfree
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+type (
+	// ExternalController talks to the mihomo external controller that xfree
+	// starts on GetExternalControllerPort.
+	ExternalController struct {
+		api *api
+		ws  *ws
+	}
+
+	ControllerVersion struct {
+		Version string `json:"version"`
+		Meta    bool   `json:"meta"`
+	}
+	ProxyDelay struct {
+		Time  time.Time `json:"time"`
+		Delay int       `json:"delay"`
+	}
+	// Proxy is a proxy or a proxy group, groups have Now and All set.
+	Proxy struct {
+		Name    string       `json:"name"`
+		Type    string       `json:"type"`
+		UDP     bool         `json:"udp"`
+		Alive   bool         `json:"alive"`
+		Hidden  bool         `json:"hidden"`
+		Now     string       `json:"now"`
+		All     []string     `json:"all"`
+		History []ProxyDelay `json:"history"`
+	}
+	Rule struct {
+		Index   int        `json:"index"`
+		Type    string     `json:"type"`
+		Payload string     `json:"payload"`
+		Proxy   string     `json:"proxy"`
+		Size    int        `json:"size"`
+		Extra   *RuleExtra `json:"extra,omitempty"` // nil on engines without rule stats
+	}
+	RuleExtra struct {
+		Disabled  bool      `json:"disabled"`
+		HitCount  int64     `json:"hitCount"`
+		HitAt     time.Time `json:"hitAt"`
+		MissCount int64     `json:"missCount"`
+		MissAt    time.Time `json:"missAt"`
+	}
+	// ControllerConfig is the part of GET /configs most callers need.
+	ControllerConfig struct {
+		Port        int    `json:"port"`
+		SocksPort   int    `json:"socks-port"`
+		RedirPort   int    `json:"redir-port"`
+		TProxyPort  int    `json:"tproxy-port"`
+		MixedPort   int    `json:"mixed-port"`
+		AllowLan    bool   `json:"allow-lan"`
+		BindAddress string `json:"bind-address"`
+		Mode        string `json:"mode"`
+		LogLevel    string `json:"log-level"`
+		IPv6        bool   `json:"ipv6"`
+	}
+	ProxyProvider struct {
+		Name        string    `json:"name"`
+		Type        string    `json:"type"`
+		VehicleType string    `json:"vehicleType"`
+		Proxies     []Proxy   `json:"proxies"`
+		UpdatedAt   time.Time `json:"updatedAt"`
+	}
+	RuleProvider struct {
+		Name        string    `json:"name"`
+		Type        string    `json:"type"`
+		VehicleType string    `json:"vehicleType"`
+		Behavior    string    `json:"behavior"`
+		RuleCount   int       `json:"ruleCount"`
+		UpdatedAt   time.Time `json:"updatedAt"`
+	}
+)
+
+func newExternalController(port int) *ExternalController {
+	address := fmt.Sprintf("127.0.0.1:%d", port)
+	return &ExternalController{
+		api: newHttpTcpClient(address),
+		ws:  newWsTcpDialer(address),
+	}
+}
+
+// ExternalController returns the client of the mihomo external controller.
+func (c *controller[S]) ExternalController() *ExternalController {
+	return c.external
+}
+
+func (e *ExternalController) getJSON(ctx context.Context, path string, query url.Values, v interface{}) error {
+	body, err := e.api.get(ctx, path, query)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+func (e *ExternalController) GetVersion(ctx context.Context) (ControllerVersion, error) {
+	var data ControllerVersion
+	err := e.getJSON(ctx, "/version", nil, &data)
+	return data, err
+}
+
+func (e *ExternalController) GetProxies(ctx context.Context) (map[string]Proxy, error) {
+	var data struct {
+		Proxies map[string]Proxy `json:"proxies"`
+	}
+	err := e.getJSON(ctx, "/proxies", nil, &data)
+	return data.Proxies, err
+}
+func (e *ExternalController) GetProxy(ctx context.Context, name string) (Proxy, error) {
+	var data Proxy
+	err := e.getJSON(ctx, "/proxies/"+url.PathEscape(name), nil, &data)
+	return data, err
+}
+
+// SelectProxy switches the selector group to the proxy name.
+func (e *ExternalController) SelectProxy(ctx context.Context, group, name string) error {
+	_, err := e.api.put(ctx, "/proxies/"+url.PathEscape(group), nil, map[string]string{
+		"name": name,
+	})
+	return err
+}
+
+// GetProxyDelay tests name against testURL and returns the delay in ms.
+func (e *ExternalController) GetProxyDelay(ctx context.Context, name, testURL string, timeout time.Duration) (int, error) {
+	var data struct {
+		Delay int `json:"delay"`
+	}
+	err := e.getJSON(ctx, "/proxies/"+url.PathEscape(name)+"/delay", delayQuery(testURL, timeout), &data)
+	return data.Delay, err
+}
+
+func (e *ExternalController) GetGroups(ctx context.Context) ([]Proxy, error) {
+	var data struct {
+		Proxies []Proxy `json:"proxies"`
+	}
+	err := e.getJSON(ctx, "/group", nil, &data)
+	return data.Proxies, err
+}
+func (e *ExternalController) GetGroup(ctx context.Context, name string) (Proxy, error) {
+	var data Proxy
+	err := e.getJSON(ctx, "/group/"+url.PathEscape(name), nil, &data)
+	return data, err
+}
+
+// GetGroupDelay tests every proxy of the group and returns delays by name.
+func (e *ExternalController) GetGroupDelay(ctx context.Context, name, testURL string, timeout time.Duration) (map[string]int, error) {
+	var data map[string]int
+	err := e.getJSON(ctx, "/group/"+url.PathEscape(name)+"/delay", delayQuery(testURL, timeout), &data)
+	return data, err
+}
+
+func (e *ExternalController) GetRules(ctx context.Context) ([]Rule, error) {
+	var data struct {
+		Rules []Rule `json:"rules"`
+	}
+	err := e.getJSON(ctx, "/rules", nil, &data)
+	return data.Rules, err
+}
+
+func (e *ExternalController) GetConnections(ctx context.Context) (Connections, error) {
+	var data Connections
+	err := e.getJSON(ctx, "/connections", nil, &data)
+	return data, err
+}
+func (e *ExternalController) CloseConnection(ctx context.Context, id string) error {
+	_, err := e.api.delete(ctx, "/connections/"+url.PathEscape(id), nil, nil)
+	return err
+}
+func (e *ExternalController) CloseAllConnections(ctx context.Context) error {
+	_, err := e.api.delete(ctx, "/connections", nil, nil)
+	return err
+}
+
+func (e *ExternalController) GetConfigs(ctx context.Context) (ControllerConfig, error) {
+	var data ControllerConfig
+	err := e.getJSON(ctx, "/configs", nil, &data)
+	return data, err
+}
+
+// PatchConfigs changes the given keys of the running config, keys use the
+// mihomo yaml names, e.g. "log-level".
+func (e *ExternalController) PatchConfigs(ctx context.Context, patch map[string]interface{}) error {
+	_, err := e.api.patch(ctx, "/configs", nil, patch)
+	return err
+}
+
+// ReloadConfigs loads the config file at path, an empty path reloads the
+// current one.
+func (e *ExternalController) ReloadConfigs(ctx context.Context, path string, force bool) error {
+	query := url.Values{}
+	query.Set("force", strconv.FormatBool(force))
+	_, err := e.api.put(ctx, "/configs", query, map[string]string{
+		"path": path,
+	})
+	return err
+}
+
+func (e *ExternalController) GetProxyProviders(ctx context.Context) (map[string]ProxyProvider, error) {
+	var data struct {
+		Providers map[string]ProxyProvider `json:"providers"`
+	}
+	err := e.getJSON(ctx, "/providers/proxies", nil, &data)
+	return data.Providers, err
+}
+func (e *ExternalController) UpdateProxyProvider(ctx context.Context, name string) error {
+	_, err := e.api.put(ctx, "/providers/proxies/"+url.PathEscape(name), nil, nil)
+	return err
+}
+func (e *ExternalController) HealthCheckProxyProvider(ctx context.Context, name string) error {
+	_, err := e.api.get(ctx, "/providers/proxies/"+url.PathEscape(name)+"/healthcheck", nil)
+	return err
+}
+func (e *ExternalController) GetRuleProviders(ctx context.Context) (map[string]RuleProvider, error) {
+	var data struct {
+		Providers map[string]RuleProvider `json:"providers"`
+	}
+	err := e.getJSON(ctx, "/providers/rules", nil, &data)
+	return data.Providers, err
+}
+func (e *ExternalController) UpdateRuleProvider(ctx context.Context, name string) error {
+	_, err := e.api.put(ctx, "/providers/rules/"+url.PathEscape(name), nil, nil)
+	return err
+}
+
+func delayQuery(testURL string, timeout time.Duration) url.Values {
+	query := url.Values{}
+	query.Set("url", testURL)
+	query.Set("timeout", strconv.FormatInt(timeout.Milliseconds(), 10))
+	return query
+}
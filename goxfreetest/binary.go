@@ -0,0 +1,161 @@
+package goxfreetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	goxfree "github.com/niubirbang/go-xfree"
+)
+
+const envScript = "GOXFREETEST_FAKE_XFREE"
+
+const (
+	BEHAVIOR_SUCCESS     Behavior = "SUCCESS"
+	BEHAVIOR_ERROR       Behavior = "ERROR"
+	BEHAVIOR_HANG        Behavior = "HANG"
+	BEHAVIOR_CRASH       Behavior = "CRASH"
+	BEHAVIOR_IGNORE_TERM Behavior = "IGNORE_TERM"
+)
+
+type (
+	Behavior string
+	// Script tells the fake binary how to behave once spawned.
+	Script struct {
+		Behavior Behavior `json:"behavior"`
+		// stages printed as CMD:PROGRESS:<stage> before the handshake
+		Progress []string `json:"progress"`
+		// delay before the handshake
+		Delay time.Duration `json:"delay"`
+		// CMD:ERROR message of BEHAVIOR_ERROR
+		Message string `json:"message"`
+		// BEHAVIOR_ERROR keeps running after CMD:ERROR until terminated
+		Linger bool `json:"linger"`
+		// BEHAVIOR_CRASH exits with ExitCode after CrashAfter
+		ExitCode   int           `json:"exitCode"`
+		CrashAfter time.Duration `json:"crashAfter"`
+		// /test fails for Unready after the handshake
+		Unready time.Duration `json:"unready"`
+		// lines printed to stdout after the handshake
+		Logs []string `json:"logs"`
+	}
+)
+
+// FakeBinary makes goxfree spawn the running test binary as a scripted fake
+// xfree. The test binary must call Main from its TestMain.
+func FakeBinary(script Script) func(*goxfree.Option) {
+	return func(o *goxfree.Option) {
+		self, err := os.Executable()
+		if err != nil {
+			panic(err)
+		}
+		body, err := json.Marshal(script)
+		if err != nil {
+			panic(err)
+		}
+		goxfree.WithCmdPath(self)(o)
+		goxfree.WithCmdEnv(envScript + "=" + string(body))(o)
+		goxfree.WithCheckPermission(false)(o)
+	}
+}
+
+// Main takes over the process when it was spawned through FakeBinary and
+// returns otherwise.
+//
+//	func TestMain(m *testing.M) {
+//		goxfreetest.Main()
+//		os.Exit(m.Run())
+//	}
+func Main() {
+	raw := os.Getenv(envScript)
+	if raw == "" {
+		return
+	}
+	var script Script
+	if err := json.Unmarshal([]byte(raw), &script); err != nil {
+		fmt.Println("CMD:ERROR:" + err.Error())
+		os.Exit(2)
+	}
+	os.Exit(runFake(script, os.Args[1:]))
+}
+
+func runFake(script Script, args []string) int {
+	mode := goxfree.MODE_CORE
+	if len(args) > 0 && args[0] == "mrun" {
+		mode = goxfree.MODE_MANAGER
+	}
+	var address string
+	for i := 0; i < len(args)-1; i++ {
+		if args[i] == "--unix" {
+			address = args[i+1]
+		}
+	}
+
+	terms := make(chan os.Signal, 1)
+	if script.Behavior == BEHAVIOR_IGNORE_TERM {
+		signal.Ignore(syscall.SIGTERM)
+	} else {
+		signal.Notify(terms, syscall.SIGTERM, os.Interrupt)
+	}
+
+	for _, stage := range script.Progress {
+		fmt.Println("CMD:PROGRESS:" + stage)
+	}
+	time.Sleep(script.Delay)
+
+	switch script.Behavior {
+	case BEHAVIOR_ERROR:
+		fmt.Println("CMD:ERROR:" + script.Message)
+		if script.Linger {
+			<-terms
+		}
+		return 1
+	case BEHAVIOR_HANG:
+		<-terms
+		return 0
+	}
+
+	server := NewServer(mode)
+	if err := server.Start(address); err != nil {
+		fmt.Println("CMD:ERROR:" + err.Error())
+		return 1
+	}
+	defer server.Close()
+	if script.Unready > 0 {
+		server.Fail("/test", Failure{
+			StatusCode: http.StatusServiceUnavailable,
+			Message:    "not ready",
+		})
+		time.AfterFunc(script.Unready, func() {
+			server.Recover("/test")
+		})
+	}
+	fmt.Fprintln(os.Stderr, `time="`+time.Now().Format(time.RFC3339)+`" level=info msg="fake xfree started"`)
+	fmt.Println("CMD:SUCCESS")
+	for _, line := range script.Logs {
+		fmt.Println(line)
+	}
+
+	quit := server.Quit()
+	var crash <-chan time.Time
+	switch script.Behavior {
+	case BEHAVIOR_CRASH:
+		crash = time.After(script.CrashAfter)
+	case BEHAVIOR_IGNORE_TERM:
+		// only SIGKILL gets rid of it
+		quit = nil
+	}
+	select {
+	case <-quit:
+		return 0
+	case <-terms:
+		return 0
+	case <-crash:
+		fmt.Fprintln(os.Stderr, "panic: fake crash")
+		return script.ExitCode
+	}
+}
@@ -0,0 +1,266 @@
+package goxfreetest
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+
+	goxfree "github.com/niubirbang/go-xfree"
+)
+
+// serveController starts the fake mihomo external controller on a random
+// local port, Option points the client at it.
+func (s *Server) serveController() error {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	s.extListener = listener
+	s.extHttp = &http.Server{
+		Handler: http.HandlerFunc(s.handleController),
+	}
+	go s.extHttp.Serve(listener)
+	return nil
+}
+
+// ControllerAddress returns the address of the fake external controller.
+func (s *Server) ControllerAddress() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.extListener == nil {
+		return ""
+	}
+	return s.extListener.Addr().String()
+}
+
+// Connections returns the connections the external controller still knows.
+func (s *Server) Connections() []goxfree.Connection {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]goxfree.Connection(nil), s.connections...)
+}
+
+// SetProxies replaces the proxies and groups of the external controller.
+// Proxies with All set are groups.
+func (s *Server) SetProxies(proxies ...goxfree.Proxy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.proxies = make(map[string]goxfree.Proxy, len(proxies))
+	for _, proxy := range proxies {
+		s.proxies[proxy.Name] = proxy
+	}
+}
+
+func (s *Server) SetRules(rules ...goxfree.Rule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = append([]goxfree.Rule(nil), rules...)
+}
+
+// SetDNS makes /dns/query answer name with answers, unknown names get
+// NXDOMAIN.
+func (s *Server) SetDNS(name string, answers ...goxfree.DNSAnswer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dns[strings.TrimSuffix(name, ".")] = answers
+}
+
+// Configs returns the running config as changed through PATCH /configs.
+func (s *Server) Configs() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	configs := make(map[string]interface{}, len(s.configs))
+	for key, value := range s.configs {
+		configs[key] = value
+	}
+	return configs
+}
+
+func (s *Server) handleController(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	path := "/" + strings.TrimLeft(r.URL.Path, "/")
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{
+		Method: r.Method,
+		Path:   path,
+		Body:   body,
+	})
+	failure, failed := s.failures[path]
+	s.mu.Unlock()
+	if failed {
+		writeError(w, failure.StatusCode, failure.Message)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i, part := range parts {
+		if p, err := url.PathUnescape(part); err == nil {
+			parts[i] = p
+		}
+	}
+	switch {
+	case r.Method == http.MethodGet && path == STREAM_LOGS:
+		s.handleListen(w, r, STREAM_LOGS)
+
+	case r.Method == http.MethodGet && path == "/version":
+		writeJSON(w, goxfree.ControllerVersion{Version: "goxfreetest", Meta: true})
+
+	case r.Method == http.MethodGet && path == "/proxies":
+		s.mu.Lock()
+		proxies := make(map[string]goxfree.Proxy, len(s.proxies))
+		for name, proxy := range s.proxies {
+			proxies[name] = proxy
+		}
+		s.mu.Unlock()
+		writeJSON(w, map[string]interface{}{"proxies": proxies})
+	case parts[0] == "proxies" && len(parts) == 2 && r.Method == http.MethodGet:
+		s.writeProxy(w, parts[1], false)
+	case parts[0] == "proxies" && len(parts) == 2 && r.Method == http.MethodPut:
+		var data struct {
+			Name string `json:"name"`
+		}
+		if !readJSON(w, body, &data) {
+			return
+		}
+		s.mu.Lock()
+		group, ok := s.proxies[parts[1]]
+		if ok && slices.Contains(group.All, data.Name) {
+			group.Now = data.Name
+			s.proxies[group.Name] = group
+		}
+		s.mu.Unlock()
+		if !ok || group.Now != data.Name {
+			writeError(w, http.StatusBadRequest, "proxy not found")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case parts[0] == "proxies" && len(parts) == 3 && parts[2] == "delay":
+		s.mu.Lock()
+		delay, ok := s.delays[parts[1]]
+		s.mu.Unlock()
+		if !ok || delay <= 0 {
+			writeError(w, http.StatusServiceUnavailable, "An error occurred in the delay test")
+			return
+		}
+		writeJSON(w, map[string]int{"delay": delay})
+
+	case r.Method == http.MethodGet && path == "/group":
+		s.mu.Lock()
+		var groups []goxfree.Proxy
+		for _, proxy := range s.proxies {
+			if len(proxy.All) > 0 {
+				groups = append(groups, proxy)
+			}
+		}
+		s.mu.Unlock()
+		sort.Slice(groups, func(i, j int) bool {
+			return groups[i].Name < groups[j].Name
+		})
+		writeJSON(w, map[string]interface{}{"proxies": groups})
+	case parts[0] == "group" && len(parts) == 2:
+		s.writeProxy(w, parts[1], true)
+	case parts[0] == "group" && len(parts) == 3 && parts[2] == "delay":
+		s.mu.Lock()
+		group, ok := s.proxies[parts[1]]
+		delays := make(map[string]int)
+		for _, name := range group.All {
+			if delay := s.delays[name]; delay > 0 {
+				delays[name] = delay
+			}
+		}
+		s.mu.Unlock()
+		if !ok || len(group.All) == 0 {
+			writeError(w, http.StatusNotFound, "resource not found")
+			return
+		}
+		writeJSON(w, delays)
+
+	case r.Method == http.MethodGet && path == "/rules":
+		s.mu.Lock()
+		rules := append([]goxfree.Rule{}, s.rules...)
+		s.mu.Unlock()
+		writeJSON(w, map[string]interface{}{"rules": rules})
+
+	case r.Method == http.MethodGet && path == "/configs":
+		writeJSON(w, s.Configs())
+	case r.Method == http.MethodPatch && path == "/configs":
+		var patch map[string]interface{}
+		if !readJSON(w, body, &patch) {
+			return
+		}
+		s.mu.Lock()
+		for key, value := range patch {
+			s.configs[key] = value
+		}
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut && path == "/configs":
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodGet && path == "/dns/query":
+		name := strings.TrimSuffix(r.URL.Query().Get("name"), ".")
+		s.mu.Lock()
+		answers := s.dns[name]
+		s.mu.Unlock()
+		result := goxfree.DNSResult{
+			Question: []goxfree.DNSQuestion{{Name: name + ".", Type: 1}},
+			Answer:   answers,
+		}
+		if len(answers) == 0 {
+			result.Status = 3
+		}
+		writeJSON(w, result)
+
+	case r.Method == http.MethodGet && path == "/providers/proxies":
+		writeJSON(w, map[string]interface{}{"providers": map[string]goxfree.ProxyProvider{}})
+	case r.Method == http.MethodGet && path == "/providers/rules":
+		writeJSON(w, map[string]interface{}{"providers": map[string]goxfree.RuleProvider{}})
+
+	case r.Method == http.MethodGet && path == "/connections":
+		s.mu.Lock()
+		data := goxfree.Connections{
+			Connections: append([]goxfree.Connection{}, s.connections...),
+		}
+		s.mu.Unlock()
+		writeJSON(w, data)
+	case r.Method == http.MethodDelete && path == "/connections":
+		s.mu.Lock()
+		s.connections = nil
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodDelete && parts[0] == "connections" && len(parts) == 2:
+		s.mu.Lock()
+		var found bool
+		for i, conn := range s.connections {
+			if conn.ID == parts[1] {
+				s.connections = append(s.connections[:i], s.connections[i+1:]...)
+				found = true
+				break
+			}
+		}
+		s.mu.Unlock()
+		if !found {
+			writeError(w, http.StatusNotFound, "connection not found")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (s *Server) writeProxy(w http.ResponseWriter, name string, group bool) {
+	s.mu.Lock()
+	proxy, ok := s.proxies[name]
+	s.mu.Unlock()
+	if !ok || group && len(proxy.All) == 0 {
+		writeError(w, http.StatusNotFound, "resource not found")
+		return
+	}
+	writeJSON(w, proxy)
+}
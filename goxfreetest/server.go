@@ -0,0 +1,581 @@
+// Package goxfreetest provides an in-process fake of the xfree server for
+// tests that must run without the real binary or network access.
+package goxfreetest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	goxfree "github.com/niubirbang/go-xfree"
+)
+
+const (
+	STREAM_MEMERY      = "/listen-memery"
+	STREAM_TRAFFIC     = "/listen-traffic"
+	STREAM_CONNECTIONS = "/listen-connections"
+	STREAM_DELAY       = "/listen-delay"
+	STREAM_STORE       = "/listen-store"
+	// engine logs of the external controller
+	STREAM_LOGS = "/logs"
+)
+
+type (
+	// Server fakes the xfree server api of either mode. The zero state is a
+	// closed, not yet configured core.
+	Server struct {
+		mu       sync.Mutex
+		mode     goxfree.Mode
+		store    goxfree.ManagerStore
+		delays   map[string]int
+		nodes    json.RawMessage
+		failures map[string]Failure
+		blocks   map[string]chan struct{}
+		requests []Request
+		conns    map[string]map[*websocket.Conn]struct{}
+		// state of the fake external controller
+		connections []goxfree.Connection
+		proxies     map[string]goxfree.Proxy
+		rules       []goxfree.Rule
+		configs     map[string]interface{}
+		dns         map[string][]goxfree.DNSAnswer
+
+		listener net.Listener
+		http     *http.Server
+		upgrader websocket.Upgrader
+		network  string
+		address  string
+		tempDir  string
+		pushMu   sync.Mutex
+		quit     chan struct{}
+		quitOnce sync.Once
+
+		extListener net.Listener
+		extHttp     *http.Server
+	}
+	// Request is a call received by the server.
+	Request struct {
+		Method string
+		Path   string
+		Body   []byte
+	}
+	// Failure makes an endpoint answer with an error.
+	Failure struct {
+		StatusCode int
+		Message    string
+	}
+)
+
+func NewServer(mode goxfree.Mode) *Server {
+	s := &Server{
+		mode: mode,
+		store: goxfree.ManagerStore{
+			CoreStore: goxfree.CoreStore{
+				Running:   true,
+				NetMode:   goxfree.MODE_SYSPROXY,
+				ProxyMode: goxfree.MODE_ABROAD,
+				Status:    goxfree.STATUS_CLOSED,
+			},
+			CurrentMode: goxfree.CURRENT_MODE_NONE,
+		},
+		delays:   make(map[string]int),
+		failures: make(map[string]Failure),
+		blocks:   make(map[string]chan struct{}),
+		conns:    make(map[string]map[*websocket.Conn]struct{}),
+		quit:     make(chan struct{}),
+		proxies:  make(map[string]goxfree.Proxy),
+		dns:      make(map[string][]goxfree.DNSAnswer),
+		configs: map[string]interface{}{
+			"mode":      "rule",
+			"log-level": "info",
+		},
+	}
+	return s
+}
+
+// Start listens on the unix socket address, removing a stale file first.
+func (s *Server) Start(address string) error {
+	if err := os.Remove(address); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	listener, err := net.Listen("unix", address)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// StartTemp listens on a fresh socket in a temporary directory.
+func (s *Server) StartTemp() error {
+	dir, err := os.MkdirTemp("", "goxfreetest")
+	if err != nil {
+		return err
+	}
+	if err := s.Start(filepath.Join(dir, "xfree.sock")); err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+	s.mu.Lock()
+	s.tempDir = dir
+	s.mu.Unlock()
+	return nil
+}
+
+// Serve answers on an existing listener, e.g. a tcp one.
+func (s *Server) Serve(listener net.Listener) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener != nil {
+		listener.Close()
+		return errors.New("server already started")
+	}
+	s.listener = listener
+	s.network = listener.Addr().Network()
+	s.address = listener.Addr().String()
+	s.http = &http.Server{
+		Handler: http.HandlerFunc(s.handle),
+	}
+	go s.http.Serve(listener)
+	return s.serveController()
+}
+
+func (s *Server) Close() error {
+	s.mu.Lock()
+	server := s.http
+	tempDir := s.tempDir
+	var conns []*websocket.Conn
+	for _, set := range s.conns {
+		for conn := range set {
+			conns = append(conns, conn)
+		}
+	}
+	s.conns = make(map[string]map[*websocket.Conn]struct{})
+	extServer := s.extHttp
+	s.mu.Unlock()
+
+	for _, conn := range conns {
+		conn.Close()
+	}
+	if tempDir != "" {
+		defer os.RemoveAll(tempDir)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if extServer != nil {
+		extServer.Shutdown(ctx)
+	}
+	if server == nil {
+		return nil
+	}
+	return server.Shutdown(ctx)
+}
+
+func (s *Server) Address() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.address
+}
+
+// Option builds an option that attaches to this server.
+func (s *Server) Option(dir string, options ...func(*goxfree.Option)) goxfree.Option {
+	s.mu.Lock()
+	network, address := s.network, s.address
+	var extPort int
+	if s.extListener != nil {
+		extPort = s.extListener.Addr().(*net.TCPAddr).Port
+	}
+	s.mu.Unlock()
+	o := goxfree.NewOption(dir, goxfree.WithAttach(true))
+	if extPort != 0 {
+		goxfree.WithExternalControllerPort(extPort)(&o)
+	}
+	if network == "unix" {
+		goxfree.WithServerUnixAddress(address)(&o)
+	} else {
+		goxfree.WithServerUnixAddress("")(&o)
+		goxfree.WithServerTcpAddress(address)(&o)
+	}
+	for _, option := range options {
+		option(&o)
+	}
+	return o
+}
+
+// Quit is closed once a client called /quit.
+func (s *Server) Quit() <-chan struct{} {
+	return s.quit
+}
+
+func (s *Server) Store() goxfree.ManagerStore {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.store
+}
+
+func (s *Server) SetStore(store goxfree.ManagerStore) {
+	s.mu.Lock()
+	s.store = store
+	s.mu.Unlock()
+	s.PushStore()
+}
+
+func (s *Server) SetDelay(name string, delay int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delays[name] = delay
+}
+
+// Nodes returns the body of the last /change-nodes call.
+func (s *Server) Nodes() json.RawMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.nodes
+}
+
+// Fail makes path answer with failure until Recover is called.
+func (s *Server) Fail(path string, failure Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[path] = failure
+}
+
+func (s *Server) Recover(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.failures, path)
+}
+
+// Block holds requests to path until Unblock is called or the client gives
+// up on them.
+func (s *Server) Block(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.blocks[path]; !ok {
+		s.blocks[path] = make(chan struct{})
+	}
+}
+
+func (s *Server) Unblock(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if block, ok := s.blocks[path]; ok {
+		close(block)
+		delete(s.blocks, path)
+	}
+}
+
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// Listeners returns the number of websocket clients on stream.
+func (s *Server) Listeners(stream string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns[stream])
+}
+
+// WaitListeners blocks until stream has at least n clients.
+func (s *Server) WaitListeners(ctx context.Context, stream string, n int) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for s.Listeners(stream) < n {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// Disconnect drops every websocket client of stream.
+func (s *Server) Disconnect(stream string) {
+	s.mu.Lock()
+	set := s.conns[stream]
+	delete(s.conns, stream)
+	s.mu.Unlock()
+	for conn := range set {
+		conn.Close()
+	}
+}
+
+func (s *Server) PushMemery(data goxfree.Memery) {
+	s.push(STREAM_MEMERY, data)
+}
+func (s *Server) PushTraffic(data goxfree.Traffic) {
+	s.push(STREAM_TRAFFIC, data)
+}
+
+// PushConnections also becomes what the external controller serves.
+func (s *Server) PushConnections(data goxfree.Connections) {
+	s.mu.Lock()
+	s.connections = append([]goxfree.Connection(nil), data.Connections...)
+	s.mu.Unlock()
+	s.push(STREAM_CONNECTIONS, data)
+}
+func (s *Server) PushDelay(data map[string]int) {
+	s.push(STREAM_DELAY, data)
+}
+func (s *Server) PushStore() {
+	s.push(STREAM_STORE, s.storeBody())
+}
+
+// PushLog sends an engine log, level uses the mihomo names, e.g. "warning".
+func (s *Server) PushLog(level, payload string) {
+	s.push(STREAM_LOGS, map[string]string{
+		"type":    level,
+		"payload": payload,
+	})
+}
+
+func (s *Server) push(stream string, data interface{}) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	var conns []*websocket.Conn
+	for conn := range s.conns[stream] {
+		conns = append(conns, conn)
+	}
+	s.mu.Unlock()
+	// gorilla allows a single concurrent writer per connection
+	s.pushMu.Lock()
+	defer s.pushMu.Unlock()
+	for _, conn := range conns {
+		if err := conn.WriteMessage(websocket.TextMessage, body); err != nil {
+			s.removeConn(stream, conn)
+		}
+	}
+}
+
+func (s *Server) removeConn(stream string, conn *websocket.Conn) {
+	s.mu.Lock()
+	delete(s.conns[stream], conn)
+	s.mu.Unlock()
+	conn.Close()
+}
+
+// the core store is what a core mode server serves
+func (s *Server) storeBody() interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.mode == goxfree.MODE_CORE {
+		return s.store.CoreStore
+	}
+	return s.store
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	path := "/" + strings.TrimLeft(r.URL.Path, "/")
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{
+		Method: r.Method,
+		Path:   path,
+		Body:   body,
+	})
+	failure, failed := s.failures[path]
+	block, blocked := s.blocks[path]
+	s.mu.Unlock()
+	if blocked {
+		select {
+		case <-block:
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if failed {
+		writeError(w, failure.StatusCode, failure.Message)
+		return
+	}
+
+	if strings.HasPrefix(path, "/listen-") {
+		s.handleListen(w, r, path)
+		return
+	}
+
+	switch r.Method + " " + path {
+	case "GET /test":
+		writeJSON(w, "ok")
+	case "GET /status":
+		writeJSON(w, s.Store().Status)
+	case "GET /net-mode":
+		writeJSON(w, s.Store().NetMode)
+	case "GET /proxy-mode":
+		writeJSON(w, s.Store().ProxyMode)
+	case "GET /delay":
+		s.mu.Lock()
+		delay := s.delays[r.URL.Query().Get("name")]
+		s.mu.Unlock()
+		writeJSON(w, delay)
+	case "GET /all-delay", "PUT /test-all-delay":
+		s.mu.Lock()
+		delays := make(map[string]int, len(s.delays))
+		for name, delay := range s.delays {
+			delays[name] = delay
+		}
+		s.mu.Unlock()
+		writeJSON(w, delays)
+	case "GET /store":
+		writeJSON(w, s.storeBody())
+	case "PUT /test-delay":
+		var name string
+		if !readJSON(w, body, &name) {
+			return
+		}
+		s.mu.Lock()
+		delay := s.delays[name]
+		s.mu.Unlock()
+		writeJSON(w, delay)
+	case "PUT /open":
+		s.update(w, func(store *goxfree.ManagerStore) {
+			store.Status = goxfree.STATUS_OPENED
+		})
+	case "PUT /close":
+		s.update(w, func(store *goxfree.ManagerStore) {
+			store.Status = goxfree.STATUS_CLOSED
+		})
+	case "PUT /change-net-mode":
+		var mode goxfree.NetMode
+		if readJSON(w, body, &mode) {
+			s.update(w, func(store *goxfree.ManagerStore) {
+				store.NetMode = mode
+			})
+		}
+	case "PUT /change-proxy-mode":
+		var mode goxfree.ProxyMode
+		if readJSON(w, body, &mode) {
+			s.update(w, func(store *goxfree.ManagerStore) {
+				store.ProxyMode = mode
+				// the engine skips its rules in global mode
+				s.configs["mode"] = "rule"
+				if mode == goxfree.MODE_GLOBAL {
+					s.configs["mode"] = "global"
+				}
+			})
+		}
+	case "PUT /change-nodes":
+		s.mu.Lock()
+		s.nodes = append(json.RawMessage(nil), body...)
+		s.mu.Unlock()
+		writeJSON(w, nil)
+	case "PUT /change-subs":
+		var subs goxfree.Subs
+		if readJSON(w, body, &subs) {
+			s.update(w, func(store *goxfree.ManagerStore) {
+				store.Subs = subs
+			})
+		}
+	case "PUT /change-node-auto":
+		s.update(w, func(store *goxfree.ManagerStore) {
+			store.Current = goxfree.AUTO_NODE_NAME
+			store.CurrentMode = goxfree.CURRENT_MODE_AUTO
+			store.CurrentChain = nil
+		})
+	case "PUT /change-node-fixed":
+		if s.mode == goxfree.MODE_CORE {
+			var name string
+			if readJSON(w, body, &name) {
+				s.update(w, func(store *goxfree.ManagerStore) {
+					store.Current = name
+				})
+			}
+			return
+		}
+		var chain goxfree.Chain
+		if readJSON(w, body, &chain) {
+			s.update(w, func(store *goxfree.ManagerStore) {
+				store.CurrentMode = goxfree.CURRENT_MODE_FIXED
+				store.CurrentChain = chain
+				if len(chain) > 0 {
+					store.Current = chain[len(chain)-1]
+				}
+			})
+		}
+	case "PUT /quit":
+		writeJSON(w, nil)
+		s.quitOnce.Do(func() {
+			close(s.quit)
+		})
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (s *Server) update(w http.ResponseWriter, fn func(*goxfree.ManagerStore)) {
+	s.mu.Lock()
+	fn(&s.store)
+	s.mu.Unlock()
+	writeJSON(w, nil)
+	s.PushStore()
+}
+
+func (s *Server) handleListen(w http.ResponseWriter, r *http.Request, stream string) {
+	switch stream {
+	case STREAM_MEMERY, STREAM_TRAFFIC, STREAM_CONNECTIONS, STREAM_DELAY, STREAM_STORE, STREAM_LOGS:
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	if s.conns[stream] == nil {
+		s.conns[stream] = make(map[*websocket.Conn]struct{})
+	}
+	s.conns[stream][conn] = struct{}{}
+	s.mu.Unlock()
+
+	// drain until the client goes away
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				s.removeConn(stream, conn)
+				return
+			}
+		}
+	}()
+}
+
+func readJSON(w http.ResponseWriter, body []byte, v interface{}) bool {
+	if err := json.Unmarshal(body, v); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+func writeError(w http.ResponseWriter, statusCode int, message string) {
+	body, _ := json.Marshal(map[string]string{
+		"message": message,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(body)
+}
@@ -0,0 +1,72 @@
+package goxfree
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var (
+	lockFileName = "xfree.lock"
+	pidFileName  = "xfree.pid"
+
+	errLocked = errors.New("locked")
+)
+
+// instanceLock keeps other hosts from running xfree out of the same dir.
+type instanceLock struct {
+	file    *os.File
+	pidPath string
+}
+
+func acquireInstanceLock(option Option) (*instanceLock, error) {
+	dir := option.GetDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	pidPath := filepath.Join(dir, pidFileName)
+	file, err := lockFile(filepath.Join(dir, lockFileName))
+	if err != nil {
+		if errors.Is(err, errLocked) {
+			pid, address := readPidFile(pidPath)
+			return nil, &AlreadyRunningError{
+				PID:     pid,
+				Address: address,
+			}
+		}
+		return nil, err
+	}
+	content := fmt.Sprintf("%d\n%s\n", os.Getpid(), option.GetServerUnixAddress())
+	if err := os.WriteFile(pidPath, []byte(content), 0644); err != nil {
+		unlockFile(file)
+		return nil, err
+	}
+	return &instanceLock{
+		file:    file,
+		pidPath: pidPath,
+	}, nil
+}
+
+func (l *instanceLock) release() {
+	_ = os.Remove(l.pidPath)
+	unlockFile(l.file)
+}
+
+// the pid file holds the owner pid on the first line and its server address
+// on the second
+func readPidFile(p string) (int, string) {
+	body, err := os.ReadFile(p)
+	if err != nil {
+		return 0, ""
+	}
+	lines := strings.Split(string(body), "\n")
+	pid, _ := strconv.Atoi(strings.TrimSpace(lines[0]))
+	var address string
+	if len(lines) > 1 {
+		address = strings.TrimSpace(lines[1])
+	}
+	return pid, address
+}
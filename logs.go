@@ -0,0 +1,366 @@
+package goxfree
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	defaultLogBufferSize = 500
+
+	logKeyValueRegexp = regexp.MustCompile(`(\w+)=("(?:[^"\\]|\\.)*"|\S+)`)
+	logBracketRegexp  = regexp.MustCompile(`^\[(\w+)\]\s*(.*)$`)
+)
+
+type (
+	// LogLine is a single line written by the core binary.
+	LogLine struct {
+		Level   LogLevel  `json:"level"`
+		Time    time.Time `json:"time"`
+		Message string    `json:"message"`
+		Stream  string    `json:"stream"`
+	}
+	// LogEntry is a log of the engine read from the external controller.
+	LogEntry struct {
+		Level   LogLevel  `json:"level"`
+		Payload string    `json:"payload"`
+		Time    time.Time `json:"time"`
+	}
+	engineLog struct {
+		Type    string `json:"type"`
+		Payload string `json:"payload"`
+	}
+	// ProcessLogs keeps the recent output of the core binary and fans it out
+	// to subscribers and the optional log file.
+	ProcessLogs struct {
+		mu    sync.Mutex
+		lines []LogLine
+		next  int
+		full  bool
+		subs  map[int]func(LogLine)
+		subID int
+		file  *rotateFile
+	}
+
+	lineWriter struct {
+		mu     sync.Mutex
+		buffer bytes.Buffer
+		fn     func(string)
+	}
+	rotateFile struct {
+		path       string
+		maxSize    int64
+		maxBackups int
+		file       *os.File
+		size       int64
+	}
+)
+
+func newProcessLogs(option Option) *ProcessLogs {
+	l := &ProcessLogs{
+		lines: make([]LogLine, option.GetLogBufferSize()),
+		subs:  make(map[int]func(LogLine)),
+	}
+	if p := option.GetLogFile(); p != "" {
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(option.GetDir(), p)
+		}
+		l.file = &rotateFile{
+			path:       p,
+			maxSize:    option.GetLogFileMaxSize(),
+			maxBackups: option.GetLogFileMaxBackups(),
+		}
+	}
+	return l
+}
+
+// Recent returns the buffered lines, oldest first.
+func (l *ProcessLogs) Recent() []LogLine {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.full {
+		return append([]LogLine(nil), l.lines[:l.next]...)
+	}
+	lines := make([]LogLine, 0, len(l.lines))
+	lines = append(lines, l.lines[l.next:]...)
+	return append(lines, l.lines[:l.next]...)
+}
+
+// Subscribe calls fn for every new line until the returned cancel is called.
+// fn runs on the goroutine reading the process output and must not block.
+func (l *ProcessLogs) Subscribe(fn func(LogLine)) (cancel func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.subID++
+	id := l.subID
+	l.subs[id] = fn
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.subs, id)
+	}
+}
+
+func (l *ProcessLogs) add(line LogLine) {
+	l.mu.Lock()
+	if len(l.lines) > 0 {
+		l.lines[l.next] = line
+		l.next++
+		if l.next == len(l.lines) {
+			l.next = 0
+			l.full = true
+		}
+	}
+	if l.file != nil {
+		if err := l.file.writeLine(line); err != nil {
+			log.Println("write xfree log failed:", err)
+		}
+	}
+	subs := make([]func(LogLine), 0, len(l.subs))
+	for _, fn := range l.subs {
+		subs = append(subs, fn)
+	}
+	l.mu.Unlock()
+
+	for _, fn := range subs {
+		fn(line)
+	}
+}
+
+// close releases the log file, the next line opens it again.
+func (l *ProcessLogs) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return
+	}
+	if err := l.file.close(); err != nil {
+		log.Println("close xfree log failed:", err)
+	}
+}
+
+func (l *ProcessLogs) writer(stream string) *lineWriter {
+	return newLineWriter(func(s string) {
+		if strings.HasPrefix(s, "CMD:") {
+			return
+		}
+		l.add(parseLogLine(s, stream))
+	})
+}
+
+func parseLogLine(s, stream string) LogLine {
+	line := LogLine{
+		Level:   LevelInfo,
+		Time:    time.Now(),
+		Message: s,
+		Stream:  stream,
+	}
+	trimmed := strings.TrimSpace(s)
+	switch {
+	case strings.HasPrefix(trimmed, "{"):
+		var data map[string]interface{}
+		if json.Unmarshal([]byte(trimmed), &data) != nil {
+			return line
+		}
+		if v, ok := data["level"].(string); ok {
+			line.Level = parseLogLevel(v)
+		}
+		for _, key := range []string{"msg", "message"} {
+			if v, ok := data[key].(string); ok {
+				line.Message = v
+				break
+			}
+		}
+		for _, key := range []string{"time", "ts"} {
+			if v, ok := data[key].(string); ok {
+				if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+					line.Time = t
+				}
+				break
+			}
+		}
+	case strings.Contains(trimmed, "level="):
+		for _, m := range logKeyValueRegexp.FindAllStringSubmatch(trimmed, -1) {
+			value := m[2]
+			if strings.HasPrefix(value, `"`) {
+				if v, err := unquoteLogValue(value); err == nil {
+					value = v
+				}
+			}
+			switch m[1] {
+			case "level":
+				line.Level = parseLogLevel(value)
+			case "msg":
+				line.Message = value
+			case "time":
+				if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+					line.Time = t
+				}
+			}
+		}
+	default:
+		if m := logBracketRegexp.FindStringSubmatch(trimmed); m != nil {
+			line.Level = parseLogLevel(m[1])
+			line.Message = m[2]
+		}
+	}
+	return line
+}
+
+func unquoteLogValue(s string) (string, error) {
+	var v string
+	err := json.Unmarshal([]byte(s), &v)
+	return v, err
+}
+
+func parseLogLevel(s string) LogLevel {
+	switch strings.ToUpper(s) {
+	case "FATAL", "PANIC":
+		return LevelFatal
+	case "ERROR", "ERR":
+		return LevelError
+	case "WARN", "WARNING":
+		return LevelWarn
+	case "DEBUG":
+		return LevelDebug
+	case "TRACE":
+		return LevelTrace
+	default:
+		return LevelInfo
+	}
+}
+
+func newLineWriter(fn func(string)) *lineWriter {
+	return &lineWriter{
+		fn: fn,
+	}
+}
+
+func (w *lineWriter) Write(p []byte) (n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n, err = w.buffer.Write(p)
+	if err != nil {
+		return
+	}
+	for {
+		line, err := w.buffer.ReadString('\n')
+		if err != nil {
+			w.buffer.WriteString(line)
+			break
+		}
+		w.fn(strings.TrimRight(line, "\r\n"))
+	}
+	return
+}
+
+func (f *rotateFile) writeLine(line LogLine) error {
+	if f.file == nil {
+		if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+			return err
+		}
+		file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		fi, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return err
+		}
+		f.file = file
+		f.size = fi.Size()
+	}
+	text := fmt.Sprintf("%s [%s] %s: %s\n", line.Time.Format(time.RFC3339Nano), line.Level, line.Stream, line.Message)
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(text)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return err
+		}
+		return f.writeLine(line)
+	}
+	n, err := f.file.WriteString(text)
+	f.size += int64(n)
+	return err
+}
+
+func (f *rotateFile) close() error {
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+func (f *rotateFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+	if f.maxBackups <= 0 {
+		return os.Remove(f.path)
+	}
+	for i := f.maxBackups - 1; i > 0; i-- {
+		from := fmt.Sprintf("%s.%d", f.path, i)
+		if _, err := os.Stat(from); err == nil {
+			if err := os.Rename(from, fmt.Sprintf("%s.%d", f.path, i+1)); err != nil {
+				return err
+			}
+		}
+	}
+	return os.Rename(f.path, f.path+".1")
+}
+
+// ListenLogs streams engine logs of level and above from the external
+// controller.
+func (c *controller[S]) ListenLogs(level LogLevel, fn func(LogEntry)) *Subscription {
+	return c.ListenLogsContext(context.Background(), level, fn)
+}
+func (c *controller[S]) ListenLogsContext(ctx context.Context, level LogLevel, fn func(LogEntry)) *Subscription {
+	if fn == nil {
+		return nil
+	}
+	dialer := func() *ws {
+		return c.external.ws
+	}
+	return listenWs(ctx, c, dialer, "/logs?level="+engineLogLevel(level), func(data engineLog) {
+		fn(LogEntry{
+			Level:   parseLogLevel(data.Type),
+			Payload: data.Payload,
+			Time:    time.Now(),
+		})
+	})
+}
+
+// ChangeLogLevel changes the engine log level without a restart.
+func (c *controller[S]) ChangeLogLevel(level LogLevel) error {
+	return c.ChangeLogLevelContext(context.Background(), level)
+}
+func (c *controller[S]) ChangeLogLevelContext(ctx context.Context, level LogLevel) error {
+	return c.UpdateRuntimeConfigContext(ctx, RuntimeConfig{
+		LogLevel: &level,
+	})
+}
+
+// engineLogLevel maps a LogLevel to the mihomo names.
+func engineLogLevel(level LogLevel) string {
+	switch level {
+	case LevelFatal, LevelError:
+		return "error"
+	case LevelWarn:
+		return "warning"
+	case LevelDebug, LevelTrace:
+		return "debug"
+	default:
+		return "info"
+	}
+}
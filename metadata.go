@@ -0,0 +1,129 @@
+package goxfree
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+type connectionMetadata ConnectionMetadata
+
+func (m *ConnectionMetadata) fields() map[string]interface{} {
+	return map[string]interface{}{
+		"network":           &m.Network,
+		"type":              &m.Type,
+		"sourceIP":          &m.SourceIP,
+		"destinationIP":     &m.DestinationIP,
+		"sourceGeoIP":       &m.SourceGeoIP,
+		"destinationGeoIP":  &m.DestinationGeoIP,
+		"sourceIPASN":       &m.SourceIPASN,
+		"destinationIPASN":  &m.DestinationIPASN,
+		"sourcePort":        &m.SourcePort,
+		"destinationPort":   &m.DestinationPort,
+		"inboundIP":         &m.InboundIP,
+		"inboundPort":       &m.InboundPort,
+		"inboundName":       &m.InboundName,
+		"inboundUser":       &m.InboundUser,
+		"host":              &m.Host,
+		"dnsMode":           &m.DNSMode,
+		"uid":               &m.UID,
+		"process":           &m.Process,
+		"processPath":       &m.ProcessPath,
+		"specialProxy":      &m.SpecialProxy,
+		"specialRules":      &m.SpecialRules,
+		"remoteDestination": &m.RemoteDestination,
+		"dscp":              &m.DSCP,
+		"sniffHost":         &m.SniffHost,
+	}
+}
+
+func (m *ConnectionMetadata) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*m = ConnectionMetadata{}
+	fields := m.fields()
+	for key, value := range raw {
+		if field, ok := fields[key]; ok && decodeTolerant(value, field) {
+			continue
+		}
+		var v interface{}
+		if err := json.Unmarshal(value, &v); err != nil {
+			return err
+		}
+		if m.Extras == nil {
+			m.Extras = make(map[string]interface{})
+		}
+		m.Extras[key] = v
+	}
+	return nil
+}
+
+func (m ConnectionMetadata) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(connectionMetadata(m))
+	if err != nil || len(m.Extras) == 0 {
+		return data, err
+	}
+	var out map[string]interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	for key, value := range m.Extras {
+		if _, ok := out[key]; !ok {
+			out[key] = value
+		}
+	}
+	return json.Marshal(out)
+}
+
+// decodeTolerant decodes value into field, accepting numbers for strings,
+// numeric strings for ints and a single string for string lists.
+func decodeTolerant(value json.RawMessage, field interface{}) bool {
+	if string(value) == "null" {
+		return true
+	}
+	switch p := field.(type) {
+	case *string:
+		if json.Unmarshal(value, p) == nil {
+			return true
+		}
+		var n json.Number
+		if json.Unmarshal(value, &n) == nil {
+			*p = n.String()
+			return true
+		}
+	case *int:
+		if json.Unmarshal(value, p) == nil {
+			return true
+		}
+		var s string
+		if json.Unmarshal(value, &s) != nil {
+			return false
+		}
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return true
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return false
+		}
+		*p = n
+		return true
+	case *[]string:
+		var list []string
+		if json.Unmarshal(value, &list) == nil {
+			*p = list
+			return true
+		}
+		var s string
+		if json.Unmarshal(value, &s) == nil {
+			if s != "" {
+				*p = []string{s}
+			}
+			return true
+		}
+	}
+	return false
+}
@@ -48,6 +48,10 @@ const (
 	MODEL_NODE  SubModel = "NODE"
 	MODEL_GROUP SubModel = "GROUP"
 	MODEL_AUTO  SubModel = "AUTO"
+
+	STAGE_SPAWN   Stage = "SPAWN"
+	STAGE_CONNECT Stage = "CONNECT"
+	STAGE_READY   Stage = "READY"
 )
 
 type (
@@ -58,6 +62,7 @@ type (
 	CurrentMode string
 	NodeModel   string
 	LogLevel    string
+	Stage       string
 
 	SubModel string
 	Chain    []string
@@ -104,13 +109,45 @@ type (
 		Down int `json:"down"`
 	}
 	Connection struct {
-		ID          string      `json:"id"`
-		Upload      int         `json:"upload"`
-		Download    int         `json:"download"`
-		Start       time.Time   `json:"start"`
-		Rule        string      `json:"rule"`
-		RulePayload string      `json:"rulePayload"`
-		Metadata    interface{} `json:"metadata"`
+		ID          string             `json:"id"`
+		Upload      int                `json:"upload"`
+		Download    int                `json:"download"`
+		Start       time.Time          `json:"start"`
+		Chains      []string           `json:"chains"`
+		Rule        string             `json:"rule"`
+		RulePayload string             `json:"rulePayload"`
+		Metadata    ConnectionMetadata `json:"metadata"`
+	}
+	// ConnectionMetadata follows the mihomo metadata schema. Ports and ids
+	// are accepted as numbers or strings, fields that do not decode and
+	// unknown fields end up in Extras.
+	ConnectionMetadata struct {
+		Network           string   `json:"network"`
+		Type              string   `json:"type"`
+		SourceIP          string   `json:"sourceIP"`
+		DestinationIP     string   `json:"destinationIP"`
+		SourceGeoIP       []string `json:"sourceGeoIP"`
+		DestinationGeoIP  []string `json:"destinationGeoIP"`
+		SourceIPASN       string   `json:"sourceIPASN"`
+		DestinationIPASN  string   `json:"destinationIPASN"`
+		SourcePort        int      `json:"sourcePort"`
+		DestinationPort   int      `json:"destinationPort"`
+		InboundIP         string   `json:"inboundIP"`
+		InboundPort       int      `json:"inboundPort"`
+		InboundName       string   `json:"inboundName"`
+		InboundUser       string   `json:"inboundUser"`
+		Host              string   `json:"host"`
+		DNSMode           string   `json:"dnsMode"`
+		UID               int      `json:"uid"`
+		Process           string   `json:"process"`
+		ProcessPath       string   `json:"processPath"`
+		SpecialProxy      string   `json:"specialProxy"`
+		SpecialRules      string   `json:"specialRules"`
+		RemoteDestination string   `json:"remoteDestination"`
+		DSCP              int      `json:"dscp"`
+		SniffHost         string   `json:"sniffHost"`
+
+		Extras map[string]interface{} `json:"-"`
 	}
 	Connections struct {
 		DownloadTotal int          `json:"downloadTotal"`
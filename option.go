@@ -19,6 +19,13 @@ var (
 	defaultNeedAuto               = true
 	defaultNeedMinDelay           = true
 	defaultServerUnixAddress      string
+	defaultStartTimeout           = 20 * time.Second
+	defaultReadyTimeout           = 10 * time.Second
+	defaultReadyInterval          = 1 * time.Second
+	defaultQuitTimeout            = 5 * time.Second
+	defaultReapOrphans            = true
+	defaultCheckPermission        = true
+	defaultFakeIPRange            = "198.18.0.1/16"
 )
 
 func init() {
@@ -32,6 +39,10 @@ type Option struct {
 	dir      string
 	logLevel *LogLevel
 
+	cmdPath         *string
+	cmdEnv          []string
+	checkPermission *bool
+
 	mixedPort              *int
 	externalControllerPort *int
 	netMode                *NetMode
@@ -43,6 +54,26 @@ type Option struct {
 	testDelayTimeout       *time.Duration
 	needAuto               *bool
 	needMinDelay           *bool
+
+	startTimeout  *time.Duration
+	readyTimeout  *time.Duration
+	readyInterval *time.Duration
+	onStage       func(Stage)
+	quitTimeout   *time.Duration
+	reapOrphans   *bool
+	attach        bool
+	restartPolicy *RestartPolicy
+	onExit        func(ProcessExit)
+
+	reconnectPolicy *ReconnectPolicy
+	onStreamState   func(StreamState)
+
+	fakeIPRange string
+
+	logBufferSize     *int
+	logFile           string
+	logFileMaxSize    int64
+	logFileMaxBackups int
 }
 
 func NewOption(dir string, options ...setter) Option {
@@ -74,6 +105,32 @@ func WithArch(arch string) setter {
 	}
 }
 
+// core: ok
+// manager: ok
+// run this executable instead of the platform binary in dir
+func WithCmdPath(path string) setter {
+	return func(o *Option) {
+		o.cmdPath = &path
+	}
+}
+
+// core: ok
+// manager: ok
+// extra KEY=value entries added to the environment of the binary
+func WithCmdEnv(env ...string) setter {
+	return func(o *Option) {
+		o.cmdEnv = append(o.cmdEnv, env...)
+	}
+}
+
+// core: ok
+// manager: ok
+func WithCheckPermission(check bool) setter {
+	return func(o *Option) {
+		o.checkPermission = &check
+	}
+}
+
 // core: ok
 // manager: ok
 func WithLogLevel(l LogLevel) setter {
@@ -170,6 +227,129 @@ func WithNeedMinDelay(need bool) setter {
 	}
 }
 
+// core: ok
+// manager: ok
+// time allowed for the binary to report CMD:SUCCESS
+func WithStartTimeout(d time.Duration) setter {
+	return func(o *Option) {
+		o.startTimeout = &d
+	}
+}
+
+// core: ok
+// manager: ok
+// time allowed for the server to answer /test after the handshake
+func WithReadyTimeout(d time.Duration) setter {
+	return func(o *Option) {
+		o.readyTimeout = &d
+	}
+}
+
+// core: ok
+// manager: ok
+// interval of the /test polling at startup and of the attach mode probe
+func WithReadyInterval(d time.Duration) setter {
+	return func(o *Option) {
+		o.readyInterval = &d
+	}
+}
+
+// core: ok
+// manager: ok
+// fn is called for the built-in stages and every CMD:PROGRESS:<stage> marker
+func WithOnStage(fn func(Stage)) setter {
+	return func(o *Option) {
+		o.onStage = fn
+	}
+}
+
+// core: ok
+// manager: ok
+// time between SIGTERM and SIGKILL when stopping the process group
+func WithQuitTimeout(d time.Duration) setter {
+	return func(o *Option) {
+		o.quitTimeout = &d
+	}
+}
+
+// core: ok
+// manager: ok
+// kill xfree processes left behind by a crashed host before spawning
+func WithReapOrphans(reap bool) setter {
+	return func(o *Option) {
+		o.reapOrphans = &reap
+	}
+}
+
+// core: ok
+// manager: ok
+// attach to a running server instead of spawning one; Quit only detaches
+func WithAttach(attach bool) setter {
+	return func(o *Option) {
+		o.attach = attach
+	}
+}
+
+// core: ok
+// manager: ok
+func WithRestartPolicy(policy RestartPolicy) setter {
+	return func(o *Option) {
+		o.restartPolicy = &policy
+	}
+}
+
+// core: ok
+// manager: ok
+func WithOnExit(fn func(ProcessExit)) setter {
+	return func(o *Option) {
+		o.onExit = fn
+	}
+}
+
+// core: ok
+// manager: ok
+func WithReconnectPolicy(policy ReconnectPolicy) setter {
+	return func(o *Option) {
+		o.reconnectPolicy = &policy
+	}
+}
+
+// core: ok
+// manager: ok
+func WithOnStreamState(fn func(StreamState)) setter {
+	return func(o *Option) {
+		o.onStreamState = fn
+	}
+}
+
+// core: ok
+// manager: ok
+// fake-ip range of the engine dns, used to flag ResolveDNS answers
+func WithFakeIPRange(cidr string) setter {
+	return func(o *Option) {
+		o.fakeIPRange = cidr
+	}
+}
+
+// core: ok
+// manager: ok
+func WithLogBufferSize(size int) setter {
+	return func(o *Option) {
+		o.logBufferSize = &size
+	}
+}
+
+// core: ok
+// manager: ok
+// a relative path is resolved against dir; maxSize <= 0 disables rotation
+func WithLogFile(path string, maxSize int64, maxBackups int) setter {
+	return func(o *Option) {
+		o.logFile = path
+		o.logFileMaxSize = maxSize
+		o.logFileMaxBackups = maxBackups
+	}
+}
+
 func (o Option) GetPlatform() string {
 	if o.platform != nil {
 		return *o.platform
@@ -185,6 +365,21 @@ func (o Option) GetArch() string {
 func (o Option) GetDir() string {
 	return o.dir
 }
+func (o Option) GetCmdPath() string {
+	if o.cmdPath != nil {
+		return *o.cmdPath
+	}
+	return path.Join(o.GetDir(), cmdNames[o.GetPlatform()+"-"+o.GetArch()])
+}
+func (o Option) GetCmdEnv() []string {
+	return o.cmdEnv
+}
+func (o Option) GetCheckPermission() bool {
+	if o.checkPermission != nil {
+		return *o.checkPermission
+	}
+	return defaultCheckPermission
+}
 func (o Option) GetLogLevel() LogLevel {
 	if o.logLevel != nil {
 		return *o.logLevel
@@ -266,3 +461,78 @@ func (o Option) GetServerTcpAddress() string {
 	}
 	return ""
 }
+func (o Option) GetStartTimeout() time.Duration {
+	if o.startTimeout != nil {
+		return *o.startTimeout
+	}
+	return defaultStartTimeout
+}
+func (o Option) GetReadyTimeout() time.Duration {
+	if o.readyTimeout != nil {
+		return *o.readyTimeout
+	}
+	return defaultReadyTimeout
+}
+func (o Option) GetReadyInterval() time.Duration {
+	if o.readyInterval != nil {
+		return *o.readyInterval
+	}
+	return defaultReadyInterval
+}
+func (o Option) GetOnStage() func(Stage) {
+	return o.onStage
+}
+func (o Option) GetQuitTimeout() time.Duration {
+	if o.quitTimeout != nil {
+		return *o.quitTimeout
+	}
+	return defaultQuitTimeout
+}
+func (o Option) GetReapOrphans() bool {
+	if o.reapOrphans != nil {
+		return *o.reapOrphans
+	}
+	return defaultReapOrphans
+}
+func (o Option) GetAttach() bool {
+	return o.attach
+}
+func (o Option) GetRestartPolicy() RestartPolicy {
+	if o.restartPolicy != nil {
+		return *o.restartPolicy
+	}
+	return RestartPolicy{}
+}
+func (o Option) GetOnExit() func(ProcessExit) {
+	return o.onExit
+}
+func (o Option) GetReconnectPolicy() ReconnectPolicy {
+	if o.reconnectPolicy != nil {
+		return *o.reconnectPolicy
+	}
+	return ReconnectPolicy{}
+}
+func (o Option) GetOnStreamState() func(StreamState) {
+	return o.onStreamState
+}
+func (o Option) GetFakeIPRange() string {
+	if o.fakeIPRange != "" {
+		return o.fakeIPRange
+	}
+	return defaultFakeIPRange
+}
+func (o Option) GetLogBufferSize() int {
+	if o.logBufferSize != nil && *o.logBufferSize >= 0 {
+		return *o.logBufferSize
+	}
+	return defaultLogBufferSize
+}
+func (o Option) GetLogFile() string {
+	return o.logFile
+}
+func (o Option) GetLogFileMaxSize() int64 {
+	return o.logFileMaxSize
+}
+func (o Option) GetLogFileMaxBackups() int {
+	return o.logFileMaxBackups
+}
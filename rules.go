@@ -0,0 +1,169 @@
+package goxfree
+
+import (
+	"context"
+	"net/netip"
+	"regexp"
+	"strings"
+)
+
+const (
+	ENGINE_MODE_RULE   = "rule"
+	ENGINE_MODE_GLOBAL = "global"
+	ENGINE_MODE_DIRECT = "direct"
+)
+
+type (
+	// RouteExplanation tells which rule routes a destination and where to.
+	// Outside ENGINE_MODE_RULE the engine consults no rule, Rule stays empty
+	// and Chain starts at the GLOBAL group or is DIRECT.
+	RouteExplanation struct {
+		Target string
+		// engine mode of the running config, one of ENGINE_MODE_*
+		Mode    string
+		Matched bool
+		// Uncertain is set when the rules stop at one that cannot be
+		// evaluated locally, e.g. GEOIP, RULE-SET or PROCESS-NAME. Rule is
+		// that rule and Matched is false, as the engine may or may not take it.
+		Uncertain bool
+		Rule      Rule // first matching rule, valid when Matched or Uncertain
+		// Rule.Proxy followed through the selected member of each group,
+		// set when Matched or outside ENGINE_MODE_RULE
+		Chain    []string
+		Outbound string
+	}
+)
+
+// GetRules returns the active rules of the engine in match order.
+func (c *controller[S]) GetRules() ([]Rule, error) {
+	return c.GetRulesContext(context.Background())
+}
+func (c *controller[S]) GetRulesContext(ctx context.Context) ([]Rule, error) {
+	return c.external.GetRules(ctx)
+}
+
+// ExplainRoute evaluates the rules against target, a host or an ip, the way
+// the engine would, and resolves the outbound through the current group
+// selections. The engine resolves a host for ip rules unless they are marked
+// no-resolve, which /rules does not report, so for a host the walk stops as
+// Uncertain at the first ip rule. ExplainResolvedRoute takes the ip as well.
+func (c *controller[S]) ExplainRoute(target string) (RouteExplanation, error) {
+	return c.ExplainRouteContext(context.Background(), target)
+}
+func (c *controller[S]) ExplainRouteContext(ctx context.Context, target string) (RouteExplanation, error) {
+	host := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(target), "."))
+	if addr, err := netip.ParseAddr(strings.Trim(host, "[]")); err == nil {
+		return c.explainRoute(ctx, target, "", addr)
+	}
+	return c.explainRoute(ctx, target, host, netip.Addr{})
+}
+
+// ExplainResolvedRoute is ExplainRoute for host resolved to addr, domain rules
+// are evaluated against host and ip rules against addr.
+func (c *controller[S]) ExplainResolvedRoute(host string, addr netip.Addr) (RouteExplanation, error) {
+	return c.ExplainResolvedRouteContext(context.Background(), host, addr)
+}
+func (c *controller[S]) ExplainResolvedRouteContext(ctx context.Context, host string, addr netip.Addr) (RouteExplanation, error) {
+	return c.explainRoute(ctx, host, strings.ToLower(strings.TrimSuffix(strings.TrimSpace(host), ".")), addr)
+}
+
+func (c *controller[S]) explainRoute(ctx context.Context, target, host string, addr netip.Addr) (RouteExplanation, error) {
+	explanation := RouteExplanation{
+		Target: target,
+	}
+	configs, err := c.external.GetConfigs(ctx)
+	if err != nil {
+		return explanation, err
+	}
+	explanation.Mode = strings.ToLower(configs.Mode)
+	switch explanation.Mode {
+	case ENGINE_MODE_GLOBAL:
+		return explanation, c.followChain(ctx, &explanation, "GLOBAL")
+	case ENGINE_MODE_DIRECT:
+		explanation.Chain = []string{"DIRECT"}
+		explanation.Outbound = "DIRECT"
+		return explanation, nil
+	}
+
+	rules, err := c.external.GetRules(ctx)
+	if err != nil {
+		return explanation, err
+	}
+	addr = addr.Unmap()
+	for _, rule := range rules {
+		if rule.Extra != nil && rule.Extra.Disabled {
+			continue
+		}
+		matched, certain := matchRule(rule, host, addr)
+		if !certain {
+			explanation.Uncertain = true
+			explanation.Rule = rule
+			break
+		}
+		if matched {
+			explanation.Matched = true
+			explanation.Rule = rule
+			break
+		}
+	}
+	if !explanation.Matched {
+		return explanation, nil
+	}
+	return explanation, c.followChain(ctx, &explanation, explanation.Rule.Proxy)
+}
+
+// followChain fills Chain and Outbound from name through the selected member
+// of each group.
+func (c *controller[S]) followChain(ctx context.Context, explanation *RouteExplanation, name string) error {
+	proxies, err := c.external.GetProxies(ctx)
+	if err != nil {
+		return err
+	}
+	visited := make(map[string]bool)
+	for name != "" && !visited[name] {
+		visited[name] = true
+		explanation.Chain = append(explanation.Chain, name)
+		explanation.Outbound = name
+		name = proxies[name].Now
+	}
+	return nil
+}
+
+// matchRule reports whether rule matches and whether that answer is certain.
+// host is empty for an ip target, addr is invalid while a host is unresolved.
+func matchRule(rule Rule, host string, addr netip.Addr) (matched, certain bool) {
+	payload := strings.ToLower(rule.Payload)
+	switch normalizeRuleType(rule.Type) {
+	case "MATCH", "FINAL":
+		return true, true
+	case "DOMAIN":
+		return host != "" && host == payload, true
+	case "DOMAINSUFFIX":
+		return host != "" && (host == payload || strings.HasSuffix(host, "."+payload)), true
+	case "DOMAINKEYWORD":
+		return host != "" && strings.Contains(host, payload), true
+	case "DOMAINREGEX":
+		re, err := regexp.Compile(rule.Payload)
+		if err != nil {
+			return false, false
+		}
+		return host != "" && re.MatchString(host), true
+	case "IPCIDR", "IPCIDR6":
+		// a host would be resolved by the engine first
+		if !addr.IsValid() {
+			return false, false
+		}
+		prefix, err := netip.ParsePrefix(rule.Payload)
+		if err != nil {
+			return false, false
+		}
+		return prefix.Contains(addr), true
+	}
+	return false, false
+}
+
+// normalizeRuleType turns both "DomainSuffix" and "DOMAIN-SUFFIX" into
+// "DOMAINSUFFIX".
+func normalizeRuleType(t string) string {
+	return strings.NewReplacer("-", "", "_", "").Replace(strings.ToUpper(t))
+}
@@ -0,0 +1,99 @@
+package goxfree
+
+import (
+	"context"
+	"maps"
+)
+
+type (
+	// RuntimeConfig is a change of the running engine config, nil fields are
+	// left alone. Extra holds further keys under their mihomo yaml names.
+	RuntimeConfig struct {
+		Port        *int
+		SocksPort   *int
+		MixedPort   *int
+		AllowLan    *bool
+		BindAddress *string
+		IPv6        *bool
+		LogLevel    *LogLevel
+		Extra       map[string]interface{}
+	}
+)
+
+func (r RuntimeConfig) patch() map[string]interface{} {
+	patch := make(map[string]interface{}, len(r.Extra)+7)
+	maps.Copy(patch, r.Extra)
+	if r.Port != nil {
+		patch["port"] = *r.Port
+	}
+	if r.SocksPort != nil {
+		patch["socks-port"] = *r.SocksPort
+	}
+	if r.MixedPort != nil {
+		patch["mixed-port"] = *r.MixedPort
+	}
+	if r.AllowLan != nil {
+		patch["allow-lan"] = *r.AllowLan
+	}
+	if r.BindAddress != nil {
+		patch["bind-address"] = *r.BindAddress
+	}
+	if r.IPv6 != nil {
+		patch["ipv6"] = *r.IPv6
+	}
+	if r.LogLevel != nil {
+		patch["log-level"] = engineLogLevel(*r.LogLevel)
+	}
+	return patch
+}
+
+// UpdateRuntimeConfig patches the running engine without a restart. Mixed
+// port and log level show up in Option, every patched key is applied again
+// after the supervisor restarted the core.
+func (c *controller[S]) UpdateRuntimeConfig(config RuntimeConfig) error {
+	return c.UpdateRuntimeConfigContext(context.Background(), config)
+}
+func (c *controller[S]) UpdateRuntimeConfigContext(ctx context.Context, config RuntimeConfig) error {
+	patch := config.patch()
+	if len(patch) == 0 {
+		return nil
+	}
+	// the engine and c.runtime see the updates in the same order
+	c.runtimeUpdate.Lock()
+	defer c.runtimeUpdate.Unlock()
+	if err := c.external.PatchConfigs(ctx, patch); err != nil {
+		return err
+	}
+	c.runtimeMu.Lock()
+	if c.runtime == nil {
+		c.runtime = make(map[string]interface{})
+		c.runtimeOption = c.client.option
+	}
+	maps.Copy(c.runtime, patch)
+	if config.MixedPort != nil {
+		WithMixedPort(*config.MixedPort)(&c.runtimeOption)
+	}
+	if config.LogLevel != nil {
+		WithLogLevel(*config.LogLevel)(&c.runtimeOption)
+	}
+	c.runtimeMu.Unlock()
+	c.replay.set("runtime-config", func(ctx context.Context) error {
+		c.runtimeMu.Lock()
+		merged := maps.Clone(c.runtime)
+		c.runtimeMu.Unlock()
+		return c.external.PatchConfigs(ctx, merged)
+	})
+	return nil
+}
+
+// Option returns the option in effect, including runtime changes. The option
+// the core was started with is never modified, a restart runs with it and
+// then applies the runtime changes again.
+func (c *controller[S]) Option() Option {
+	c.runtimeMu.Lock()
+	defer c.runtimeMu.Unlock()
+	if c.runtime == nil {
+		return c.client.option
+	}
+	return c.runtimeOption
+}
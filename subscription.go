@@ -0,0 +1,213 @@
+package goxfree
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	STREAM_CONNECTING   StreamStatus = "CONNECTING"
+	STREAM_CONNECTED    StreamStatus = "CONNECTED"
+	STREAM_DISCONNECTED StreamStatus = "DISCONNECTED"
+)
+
+var (
+	defaultReconnectJitter = 0.2
+
+	closedChan = func() chan struct{} {
+		ch := make(chan struct{})
+		close(ch)
+		return ch
+	}()
+)
+
+type (
+	// ReconnectPolicy controls how a dropped stream is dialed again.
+	// A zero MaxAttempts retries forever.
+	ReconnectPolicy struct {
+		MaxAttempts int
+		Backoff     time.Duration
+		MaxBackoff  time.Duration
+		Multiplier  float64
+		// random spread of each delay, 0.2 means ±20%; negative disables it
+		Jitter float64
+	}
+	StreamStatus string
+	// StreamState is reported through WithOnStreamState whenever a stream
+	// changes state.
+	StreamState struct {
+		Stream  string
+		Status  StreamStatus
+		Attempt int   // dial attempt since the last connection, from 1
+		Err     error // reason of STREAM_DISCONNECTED
+	}
+
+	// Subscription is a running Listen stream. It reconnects following the
+	// ReconnectPolicy until Close is called, its context ends, the attempts
+	// run out or the Core/Manager quits.
+	Subscription struct {
+		cancel context.CancelCauseFunc
+		done   chan struct{}
+		mu     sync.Mutex
+		err    error
+	}
+	subscriptions struct {
+		mu   sync.Mutex
+		subs map[*Subscription]struct{}
+	}
+)
+
+func (s *Subscription) Close() {
+	if s == nil {
+		return
+	}
+	s.cancel(ErrSubscriptionClosed)
+}
+
+// Done is closed once the stream stopped.
+func (s *Subscription) Done() <-chan struct{} {
+	if s == nil {
+		return closedChan
+	}
+	return s.done
+}
+
+// Err returns nil while the stream runs and the reason it stopped after.
+func (s *Subscription) Err() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func newSubscriptions() *subscriptions {
+	return &subscriptions{
+		subs: make(map[*Subscription]struct{}),
+	}
+}
+
+func (s *subscriptions) add(sub *Subscription) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subs[sub] = struct{}{}
+}
+
+func (s *subscriptions) remove(sub *Subscription) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.subs, sub)
+}
+
+func (s *subscriptions) closeAll() {
+	s.mu.Lock()
+	subs := make([]*Subscription, 0, len(s.subs))
+	for sub := range s.subs {
+		subs = append(subs, sub)
+	}
+	s.mu.Unlock()
+	for _, sub := range subs {
+		sub.Close()
+	}
+}
+
+// listen streams the messages of path into fn until the subscription ends.
+func listen[S Store, T any](ctx context.Context, c *controller[S], path string, fn func(T)) *Subscription {
+	return listenWs(ctx, c, func() *ws { return c.ws }, path, fn)
+}
+
+// listenWs is listen on another websocket endpoint, dialer is called for
+// every connection attempt.
+func listenWs[S Store, T any](ctx context.Context, c *controller[S], dialer func() *ws, path string, fn func(T)) *Subscription {
+	if fn == nil {
+		return nil
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	sub := &Subscription{
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	c.subs.add(sub)
+	go func() {
+		defer func() {
+			c.subs.remove(sub)
+			sub.mu.Lock()
+			sub.err = context.Cause(ctx)
+			sub.mu.Unlock()
+			close(sub.done)
+		}()
+		policy := c.client.option.GetReconnectPolicy()
+		report := c.client.option.GetOnStreamState()
+		if report == nil {
+			report = func(StreamState) {}
+		}
+		var (
+			connected bool
+			attempt   int
+		)
+		for {
+			attempt++
+			report(StreamState{Stream: path, Status: STREAM_CONNECTING, Attempt: attempt})
+			conn, err := dialer().conn(ctx, path)
+			if err != nil {
+				if ctx.Err() != nil {
+					report(StreamState{Stream: path, Status: STREAM_DISCONNECTED, Attempt: attempt, Err: context.Cause(ctx)})
+					return
+				}
+				report(StreamState{Stream: path, Status: STREAM_DISCONNECTED, Attempt: attempt, Err: err})
+				if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+					cancel(fmt.Errorf("%w: %s after %d attempts: %w", ErrStreamUnavailable, path, attempt, err))
+					return
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(policy.delay(attempt)):
+				}
+				continue
+			}
+			report(StreamState{Stream: path, Status: STREAM_CONNECTED, Attempt: attempt})
+			if connected {
+				c.events.emit(Event{Type: EVENT_RECONNECTED, Stream: path})
+			}
+			connected = true
+			attempt = 0
+			stop := context.AfterFunc(ctx, func() {
+				conn.Close()
+			})
+			for {
+				var msg []byte
+				_, msg, err = conn.ReadMessage()
+				if err != nil {
+					break
+				}
+				var data T
+				if err := json.Unmarshal(msg, &data); err == nil {
+					fn(data)
+				}
+			}
+			stop()
+			conn.Close()
+			if ctx.Err() != nil {
+				err = context.Cause(ctx)
+			}
+			report(StreamState{Stream: path, Status: STREAM_DISCONNECTED, Err: err})
+			if ctx.Err() != nil {
+				return
+			}
+		}
+	}()
+	return sub
+}
+
+func (p ReconnectPolicy) delay(attempt int) time.Duration {
+	jitter := p.Jitter
+	if jitter == 0 {
+		jitter = defaultReconnectJitter
+	}
+	return backoffDelay(attempt, p.Backoff, p.MaxBackoff, p.Multiplier, jitter)
+}
@@ -0,0 +1,291 @@
+package goxfree
+
+import (
+	"context"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	// defaults of RestartPolicy and ReconnectPolicy
+	defaultBackoff    = 1 * time.Second
+	defaultMaxBackoff = 30 * time.Second
+	defaultMultiplier = 2.0
+
+	// failed probes in a row after which an attached server counts as gone
+	attachProbeFailures = 3
+
+	// replay order of the remembered state after a restart
+	replayOrder = []string{"nodes", "subs", "node", "net-mode", "proxy-mode", "runtime-config", "status"}
+)
+
+type (
+	// RestartPolicy controls how a crashed core is brought back.
+	// A zero MaxRestarts disables restarting.
+	RestartPolicy struct {
+		MaxRestarts int
+		Backoff     time.Duration
+		MaxBackoff  time.Duration
+		Multiplier  float64
+		// a run lasting at least ResetAfter resets the attempt counter
+		ResetAfter time.Duration
+	}
+	// ProcessExit describes an unexpected exit of the core process.
+	ProcessExit struct {
+		Code    int
+		Signal  os.Signal
+		Stderr  []string
+		Output  []string
+		Uptime  time.Duration
+		Attempt int   // restart attempt that follows, 0 when not restarting
+		Err     error // set when the core could not be restarted or an attached server is gone
+	}
+
+	supervisor struct {
+		mu      sync.Mutex
+		client  *client
+		start   func(context.Context) error
+		restore func(context.Context) error
+		ctx     context.Context
+		cancel  context.CancelFunc
+		attempt int
+		done    chan struct{}
+		err     error
+		notify  func(Event)
+	}
+	replay struct {
+		mu    sync.Mutex
+		steps map[string]func(context.Context) error
+	}
+)
+
+func (p RestartPolicy) backoff(attempt int) time.Duration {
+	return backoffDelay(attempt, p.Backoff, p.MaxBackoff, p.Multiplier, 0)
+}
+
+// backoffDelay grows backoff by multiplier for each attempt, from 1, up to
+// maxBackoff, zero values take the defaults. A jitter in (0, 1] spreads the
+// result by ±jitter.
+func backoffDelay(attempt int, backoff, maxBackoff time.Duration, multiplier, jitter float64) time.Duration {
+	if backoff <= 0 {
+		backoff = defaultBackoff
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = defaultMaxBackoff
+	}
+	if multiplier < 1 {
+		multiplier = defaultMultiplier
+	}
+	d := time.Duration(float64(backoff) * math.Pow(multiplier, float64(attempt-1)))
+	if d <= 0 || d > maxBackoff {
+		d = maxBackoff
+	}
+	if jitter > 1 {
+		jitter = 1
+	}
+	if jitter > 0 {
+		d += time.Duration((rand.Float64()*2 - 1) * jitter * float64(d))
+	}
+	return d
+}
+
+func newSupervisor(client *client, start, restore func(context.Context) error) *supervisor {
+	s := &supervisor{
+		client:  client,
+		start:   start,
+		restore: restore,
+		done:    make(chan struct{}),
+	}
+	client.onExit = s.exited
+	return s
+}
+
+func (s *supervisor) watch() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.attempt = 0
+	select {
+	case <-s.done:
+		s.done = make(chan struct{})
+		s.err = nil
+	default:
+	}
+}
+
+// probe watches a server that is not our child, the run finishes with the
+// last error of check once it failed attachProbeFailures times in a row.
+func (s *supervisor) probe(interval time.Duration, check func(context.Context) error) {
+	s.mu.Lock()
+	ctx := s.ctx
+	s.mu.Unlock()
+	if ctx == nil {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var failures int
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			err := check(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			if err == nil {
+				failures = 0
+				continue
+			}
+			failures++
+			if failures >= attachProbeFailures {
+				s.report(ProcessExit{Code: -1, Err: err})
+				s.finish(err)
+				return
+			}
+		}
+	}()
+}
+
+func (s *supervisor) stop() {
+	s.finish(nil)
+}
+
+// finish ends the current run; only the first call records err
+func (s *supervisor) finish(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ctx == nil {
+		return
+	}
+	s.cancel()
+	s.ctx, s.cancel = nil, nil
+	s.err = err
+	close(s.done)
+	if s.notify != nil {
+		go s.notify(Event{Type: EVENT_STOPPED, Err: err})
+	}
+}
+
+func (s *supervisor) Done() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.done
+}
+
+func (s *supervisor) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *supervisor) exited(exit ProcessExit) {
+	policy := s.client.option.GetRestartPolicy()
+
+	s.mu.Lock()
+	ctx := s.ctx
+	if ctx == nil || ctx.Err() != nil {
+		s.mu.Unlock()
+		return
+	}
+	if policy.ResetAfter > 0 && exit.Uptime >= policy.ResetAfter {
+		s.attempt = 0
+	}
+	s.attempt++
+	attempt := s.attempt
+	s.mu.Unlock()
+
+	if attempt <= policy.MaxRestarts {
+		exit.Attempt = attempt
+	}
+	s.report(exit)
+	if exit.Attempt > 0 {
+		go s.restart(ctx, attempt)
+		return
+	}
+	s.finish(&ExitError{
+		Code:   exit.Code,
+		Signal: exit.Signal,
+		Output: exit.Output,
+	})
+}
+
+func (s *supervisor) restart(ctx context.Context, attempt int) {
+	policy := s.client.option.GetRestartPolicy()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(policy.backoff(attempt)):
+		}
+		err := s.start(ctx)
+		if err == nil {
+			if err := s.restore(ctx); err != nil {
+				log.Println("restore xfree state failed:", err)
+			}
+			if s.notify != nil {
+				s.notify(Event{Type: EVENT_STARTED})
+			}
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		log.Println("restart xfree failed:", err)
+
+		s.mu.Lock()
+		s.attempt++
+		attempt = s.attempt
+		s.mu.Unlock()
+		if attempt > policy.MaxRestarts {
+			s.report(ProcessExit{Code: -1, Err: err})
+			s.finish(err)
+			return
+		}
+	}
+}
+
+func (s *supervisor) report(exit ProcessExit) {
+	if fn := s.client.option.GetOnExit(); fn != nil {
+		fn(exit)
+	}
+}
+
+func newReplay() *replay {
+	return &replay{
+		steps: make(map[string]func(context.Context) error),
+	}
+}
+
+func (r *replay) set(key string, step func(context.Context) error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.steps[key] = step
+}
+
+func (r *replay) run(ctx context.Context) error {
+	r.mu.Lock()
+	var steps []func(context.Context) error
+	for _, key := range replayOrder {
+		if step, ok := r.steps[key]; ok {
+			steps = append(steps, step)
+		}
+	}
+	r.mu.Unlock()
+	for _, step := range steps {
+		if err := step(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
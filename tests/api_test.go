@@ -0,0 +1,64 @@
+package goxfree
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	goxfree "github.com/niubirbang/go-xfree"
+	"github.com/niubirbang/go-xfree/goxfreetest"
+)
+
+func TestAPIError(t *testing.T) {
+	server := startServer(t, goxfree.MODE_CORE)
+	core := goxfree.NewCore(server.Option(t.TempDir()))
+	if err := core.Run(); err != nil {
+		t.Fatal("Run failed:", err)
+	}
+	defer core.Quit()
+
+	server.Fail("/open", goxfreetest.Failure{
+		StatusCode: http.StatusBadRequest,
+		Message:    "no nodes",
+	})
+	var apiErr *goxfree.APIError
+	if err := core.Open(); !errors.As(err, &apiErr) {
+		t.Fatal("Open error:", err)
+	}
+	if apiErr.StatusCode != http.StatusBadRequest || apiErr.Message != "no nodes" || apiErr.Endpoint != "/open" {
+		t.Errorf("API error: %+v", apiErr)
+	}
+
+	server.Close()
+	if _, err := core.GetStatus(); !errors.Is(err, goxfree.ErrNotRunning) {
+		t.Error("Get status after close:", err)
+	}
+}
+
+func TestAPICancel(t *testing.T) {
+	server := startServer(t, goxfree.MODE_CORE)
+	core := goxfree.NewCore(server.Option(t.TempDir()))
+	if err := core.Run(); err != nil {
+		t.Fatal("Run failed:", err)
+	}
+	defer core.Quit()
+
+	server.Block("/status")
+	defer server.Unblock("/status")
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	if _, err := core.GetStatusContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatal("Get status error:", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Error("Cancel took:", d)
+	}
+
+	server.Unblock("/status")
+	if _, err := core.GetStatus(); err != nil {
+		t.Error("Get status after unblock:", err)
+	}
+}
@@ -0,0 +1,133 @@
+package goxfree
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	goxfree "github.com/niubirbang/go-xfree"
+	"github.com/niubirbang/go-xfree/goxfreetest"
+)
+
+func startServer(t *testing.T, mode goxfree.Mode) *goxfreetest.Server {
+	server := goxfreetest.NewServer(mode)
+	if err := server.StartTemp(); err != nil {
+		t.Fatal("Start server failed:", err)
+	}
+	t.Cleanup(func() {
+		server.Close()
+	})
+	return server
+}
+
+func TestAttachCore(t *testing.T) {
+	server := startServer(t, goxfree.MODE_CORE)
+	option := server.Option(t.TempDir())
+
+	mode, err := goxfree.DetectMode(context.Background(), option)
+	if err != nil || mode != goxfree.MODE_CORE {
+		t.Fatalf("Detect mode: %s, %v", mode, err)
+	}
+
+	core := goxfree.NewCore(option)
+	if err := core.Run(); err != nil {
+		t.Fatal("Run failed:", err)
+	}
+
+	stores := make(chan goxfree.CoreStore, 4)
+	core.ListenStore(func(store goxfree.CoreStore) {
+		stores <- store
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.WaitListeners(ctx, goxfreetest.STREAM_STORE, 1); err != nil {
+		t.Fatal("Wait listener failed:", err)
+	}
+
+	if err := core.ChangeNetMode(goxfree.MODE_TUN); err != nil {
+		t.Fatal("Change net mode failed:", err)
+	}
+	select {
+	case store := <-stores:
+		if store.NetMode != goxfree.MODE_TUN {
+			t.Error("Listen store:", store)
+		}
+	case <-ctx.Done():
+		t.Fatal("Listen store timeout")
+	}
+	if err := core.ChangeNodeFixed("node-a"); err != nil {
+		t.Fatal("Change node fixed failed:", err)
+	}
+	store, err := core.GetStore()
+	if err != nil || store.Current != "node-a" {
+		t.Fatalf("Get store: %+v, %v", store, err)
+	}
+
+	if err := core.Quit(); err != nil {
+		t.Fatal("Quit failed:", err)
+	}
+	select {
+	case <-core.Done():
+	default:
+		t.Error("Done not closed after quit")
+	}
+	select {
+	case <-server.Quit():
+		t.Error("Quit in attach mode stopped the server")
+	default:
+	}
+}
+
+func TestAttachModeMismatch(t *testing.T) {
+	server := startServer(t, goxfree.MODE_MANAGER)
+	err := goxfree.NewCore(server.Option(t.TempDir())).Run()
+	var mismatchErr *goxfree.ModeMismatchError
+	if !errors.Is(err, goxfree.ErrModeMismatch) || !errors.As(err, &mismatchErr) {
+		t.Fatal("Attach core to a manager:", err)
+	}
+	if mismatchErr.Want != goxfree.MODE_CORE || mismatchErr.Got != goxfree.MODE_MANAGER {
+		t.Errorf("Mode mismatch: %+v", mismatchErr)
+	}
+	manager := goxfree.NewManager(server.Option(t.TempDir()))
+	if err := manager.Run(); err != nil {
+		t.Fatal("Attach manager failed:", err)
+	}
+	defer manager.Quit()
+
+	if err := manager.ChangeNodeFixed(goxfree.Chain{"sub", "node-b"}); err != nil {
+		t.Fatal("Change node fixed failed:", err)
+	}
+	store, err := manager.GetStore()
+	if err != nil || store.CurrentMode != goxfree.CURRENT_MODE_FIXED || store.Current != "node-b" {
+		t.Fatalf("Get store: %+v, %v", store, err)
+	}
+}
+
+func TestAttachServerGone(t *testing.T) {
+	server := startServer(t, goxfree.MODE_CORE)
+	exits := make(chan goxfree.ProcessExit, 1)
+	core := goxfree.NewCore(server.Option(t.TempDir(),
+		goxfree.WithReadyInterval(50*time.Millisecond),
+		goxfree.WithOnExit(func(exit goxfree.ProcessExit) {
+			exits <- exit
+		}),
+	))
+	if err := core.Run(); err != nil {
+		t.Fatal("Run failed:", err)
+	}
+	defer core.Quit()
+
+	server.Close()
+	select {
+	case <-core.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Done not closed after the server went away")
+	}
+	if !errors.Is(core.Err(), goxfree.ErrNotRunning) {
+		t.Error("Err:", core.Err())
+	}
+	if exit := <-exits; exit.Err == nil {
+		t.Error("Exit:", exit)
+	}
+}
@@ -0,0 +1,105 @@
+package goxfree
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	goxfree "github.com/niubirbang/go-xfree"
+	"github.com/niubirbang/go-xfree/goxfreetest"
+)
+
+func TestConnectionTracker(t *testing.T) {
+	server := startServer(t, goxfree.MODE_CORE)
+	core := goxfree.NewCore(server.Option(t.TempDir()))
+	if err := core.Run(); err != nil {
+		t.Fatal("Run failed:", err)
+	}
+	defer core.Quit()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	events := make(chan goxfree.ConnectionEvent, 16)
+	tracker := goxfree.NewConnectionTracker(ctx, core, 0, func(e goxfree.ConnectionEvent) {
+		events <- e
+	})
+	defer tracker.Close()
+	if err := server.WaitListeners(ctx, goxfreetest.STREAM_CONNECTIONS, 1); err != nil {
+		t.Fatal("Wait listener failed:", err)
+	}
+
+	next := func() goxfree.ConnectionEvent {
+		select {
+		case e := <-events:
+			return e
+		case <-ctx.Done():
+			t.Fatal("Wait connection event timeout")
+		}
+		return goxfree.ConnectionEvent{}
+	}
+	server.PushConnections(goxfree.Connections{Connections: []goxfree.Connection{
+		{ID: "a", Upload: 10, Download: 100},
+		{ID: "b", Upload: 1, Download: 1},
+	}})
+	if e := next(); e.Type != goxfree.CONNECTION_OPENED || e.Connection.ID != "a" {
+		t.Errorf("Event: %+v", e)
+	}
+	if e := next(); e.Type != goxfree.CONNECTION_OPENED || e.Connection.ID != "b" {
+		t.Errorf("Event: %+v", e)
+	}
+
+	server.PushConnections(goxfree.Connections{Connections: []goxfree.Connection{
+		{ID: "a", Upload: 15, Download: 300},
+	}})
+	if e := next(); e.Type != goxfree.CONNECTION_UPDATED || e.UploadDelta != 5 || e.DownloadDelta != 200 || e.DownloadRate <= 0 {
+		t.Errorf("Event: %+v", e)
+	}
+	if e := next(); e.Type != goxfree.CONNECTION_CLOSED || e.Connection.ID != "b" {
+		t.Errorf("Event: %+v", e)
+	}
+
+	if active := tracker.Active(); len(active) != 1 || active[0].Download != 300 {
+		t.Error("Active:", active)
+	}
+	if closed := tracker.Closed(); len(closed) != 1 || closed[0].ID != "b" || closed[0].Closed.IsZero() {
+		t.Error("Closed:", closed)
+	}
+}
+
+func TestCloseConnections(t *testing.T) {
+	server := startServer(t, goxfree.MODE_MANAGER)
+	manager := goxfree.NewManager(server.Option(t.TempDir()))
+	if err := manager.Run(); err != nil {
+		t.Fatal("Run failed:", err)
+	}
+	defer manager.Quit()
+
+	server.PushConnections(goxfree.Connections{Connections: []goxfree.Connection{
+		{ID: "a", Chains: []string{"node-a"}, Metadata: goxfree.ConnectionMetadata{Host: "example.com"}},
+		{ID: "b", Chains: []string{"node-b"}, Metadata: goxfree.ConnectionMetadata{Host: "example.com", Process: "curl"}},
+		{ID: "c", Chains: []string{"node-b"}, Rule: "Match"},
+	}})
+
+	closed, err := manager.CloseConnections(goxfree.ConnectionFilter{Host: "EXAMPLE.com", Chain: "node-b"})
+	if err != nil || closed != 1 {
+		t.Fatal("Close filtered:", closed, err)
+	}
+	if err := manager.CloseConnection("c"); err != nil {
+		t.Fatal("Close c failed:", err)
+	}
+	if conns := server.Connections(); len(conns) != 1 || conns[0].ID != "a" {
+		t.Error("Connections left:", conns)
+	}
+	var apiErr *goxfree.APIError
+	if err := manager.CloseConnection("missing"); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Error("Close missing:", err)
+	}
+	if err := manager.CloseAllConnections(); err != nil {
+		t.Fatal("Close all failed:", err)
+	}
+	if conns := server.Connections(); len(conns) != 0 {
+		t.Error("Connections left:", conns)
+	}
+}
@@ -0,0 +1,53 @@
+package goxfree
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	goxfree "github.com/niubirbang/go-xfree"
+	"github.com/niubirbang/go-xfree/goxfreetest"
+)
+
+func TestResolveDNS(t *testing.T) {
+	server := startServer(t, goxfree.MODE_CORE)
+	server.SetDNS("example.com", goxfree.DNSAnswer{Name: "example.com.", Type: 1, TTL: 1, Data: "198.18.0.7"})
+	core := goxfree.NewCore(server.Option(t.TempDir()))
+	if err := core.Run(); err != nil {
+		t.Fatal("Run failed:", err)
+	}
+	defer core.Quit()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := core.ResolveDNS(ctx, "example.com", "A")
+	if err != nil || len(result.Answer) != 1 || result.Answer[0].Data != "198.18.0.7" {
+		t.Fatalf("Resolve: %+v, %v", result, err)
+	}
+	if result.FakeIP {
+		t.Error("Fake ip outside tun mode")
+	}
+
+	if err := core.ChangeNetMode(goxfree.MODE_TUN); err != nil {
+		t.Fatal("Change net mode failed:", err)
+	}
+	result, err = core.ResolveDNS(ctx, "example.com", "")
+	if err != nil || !result.FakeIP || !result.Answer[0].FakeIP {
+		t.Errorf("Resolve in tun mode: %+v, %v", result, err)
+	}
+
+	server.Fail("/net-mode", goxfreetest.Failure{
+		StatusCode: http.StatusInternalServerError,
+		Message:    "busy",
+	})
+	result, err = core.ResolveDNS(ctx, "example.com", "A")
+	if err != nil || len(result.Answer) != 1 || result.FakeIP || result.Answer[0].FakeIP {
+		t.Errorf("Resolve without net mode: %+v, %v", result, err)
+	}
+	server.Recover("/net-mode")
+
+	if result, err := core.ResolveDNS(ctx, "missing.example", "A"); err != nil || result.Status != 3 {
+		t.Errorf("Resolve missing: %+v, %v", result, err)
+	}
+}
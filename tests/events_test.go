@@ -0,0 +1,132 @@
+package goxfree
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	goxfree "github.com/niubirbang/go-xfree"
+	"github.com/niubirbang/go-xfree/goxfreetest"
+)
+
+func nextEvent(t *testing.T, events <-chan goxfree.Event, typ goxfree.EventType) goxfree.Event {
+	t.Helper()
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				t.Fatalf("Events closed before %s", typ)
+			}
+			if e.Type == typ {
+				return e
+			}
+		case <-timeout:
+			t.Fatalf("Wait %s timeout", typ)
+		}
+	}
+}
+
+func TestEvents(t *testing.T) {
+	server := startServer(t, goxfree.MODE_CORE)
+	core := goxfree.NewCore(server.Option(t.TempDir()))
+	if err := core.Run(); err != nil {
+		t.Fatal("Run failed:", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	events := core.Events(ctx)
+	if err := server.WaitListeners(ctx, goxfreetest.STREAM_MEMERY, 1); err != nil {
+		t.Fatal("Wait listener failed:", err)
+	}
+
+	server.PushMemery(goxfree.Memery{Inuse: 42})
+	if e := nextEvent(t, events, goxfree.EVENT_MEMERY); e.Memery == nil || e.Memery.Inuse != 42 {
+		t.Errorf("Memery event: %+v", e)
+	}
+
+	server.Disconnect(goxfreetest.STREAM_MEMERY)
+	if e := nextEvent(t, events, goxfree.EVENT_RECONNECTED); e.Stream != goxfreetest.STREAM_MEMERY {
+		t.Errorf("Reconnected event: %+v", e)
+	}
+
+	if err := core.Quit(); err != nil {
+		t.Fatal("Quit failed:", err)
+	}
+	if e := nextEvent(t, events, goxfree.EVENT_STOPPED); e.Err != nil {
+		t.Errorf("Stopped event: %+v", e)
+	}
+	select {
+	case _, ok := <-events:
+		for ok {
+			_, ok = <-events
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Events not closed after stop")
+	}
+}
+
+func TestEventsStalledReader(t *testing.T) {
+	server := startServer(t, goxfree.MODE_CORE)
+	core := goxfree.NewCore(server.Option(t.TempDir()))
+	if err := core.Run(); err != nil {
+		t.Fatal("Run failed:", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	events := core.Events(ctx)
+	if err := server.WaitListeners(ctx, goxfreetest.STREAM_MEMERY, 1); err != nil {
+		t.Fatal("Wait listener failed:", err)
+	}
+	// nobody reads events, the buffer fills up
+	for i := 0; i < 80; i++ {
+		server.PushMemery(goxfree.Memery{Inuse: i})
+	}
+	for len(events) < cap(events) {
+		select {
+		case <-ctx.Done():
+			t.Fatal("Wait full buffer timeout:", len(events))
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	traffic := make(chan goxfree.Traffic, 1)
+	sub := core.ListenTrafficContext(ctx, func(data goxfree.Traffic) {
+		select {
+		case traffic <- data:
+		default:
+		}
+	})
+	defer sub.Close()
+	if err := server.WaitListeners(ctx, goxfreetest.STREAM_TRAFFIC, 2); err != nil {
+		t.Fatal("Wait listener failed:", err)
+	}
+	// the reconnect emits EVENT_RECONNECTED into the full buffer
+	server.Disconnect(goxfreetest.STREAM_TRAFFIC)
+	if err := server.WaitListeners(ctx, goxfreetest.STREAM_TRAFFIC, 2); err != nil {
+		t.Fatal("Wait reconnect failed:", err)
+	}
+	server.PushTraffic(goxfree.Traffic{Up: 1})
+	select {
+	case <-traffic:
+	case <-ctx.Done():
+		t.Fatal("Subscription stalled by the events reader")
+	}
+
+	if err := core.Quit(); err != nil {
+		t.Fatal("Quit failed:", err)
+	}
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("Events not closed after stop")
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package goxfree
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	goxfree "github.com/niubirbang/go-xfree"
+	"github.com/niubirbang/go-xfree/goxfreetest"
+)
+
+func TestExternalController(t *testing.T) {
+	server := startServer(t, goxfree.MODE_CORE)
+	server.SetProxies(
+		goxfree.Proxy{Name: "node-a", Type: "Shadowsocks"},
+		goxfree.Proxy{Name: "node-b", Type: "Vmess"},
+		goxfree.Proxy{Name: "proxy", Type: "Selector", Now: "node-a", All: []string{"node-a", "node-b"}},
+	)
+	server.SetRules(goxfree.Rule{Type: "DomainSuffix", Payload: "example.com", Proxy: "proxy"})
+	server.SetDelay("node-b", 120)
+
+	core := goxfree.NewCore(server.Option(t.TempDir()))
+	if err := core.Run(); err != nil {
+		t.Fatal("Run failed:", err)
+	}
+	defer core.Quit()
+	ext := core.ExternalController()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if version, err := ext.GetVersion(ctx); err != nil || !version.Meta {
+		t.Errorf("Get version: %+v, %v", version, err)
+	}
+	if proxies, err := ext.GetProxies(ctx); err != nil || len(proxies) != 3 {
+		t.Errorf("Get proxies: %v, %v", proxies, err)
+	}
+	if err := ext.SelectProxy(ctx, "proxy", "node-b"); err != nil {
+		t.Fatal("Select proxy failed:", err)
+	}
+	if group, err := ext.GetGroup(ctx, "proxy"); err != nil || group.Now != "node-b" {
+		t.Errorf("Get group: %+v, %v", group, err)
+	}
+	if groups, err := ext.GetGroups(ctx); err != nil || len(groups) != 1 {
+		t.Errorf("Get groups: %v, %v", groups, err)
+	}
+	if delay, err := ext.GetProxyDelay(ctx, "node-b", "https://example.com", time.Second); err != nil || delay != 120 {
+		t.Errorf("Get proxy delay: %d, %v", delay, err)
+	}
+	var apiErr *goxfree.APIError
+	if _, err := ext.GetProxyDelay(ctx, "node-a", "https://example.com", time.Second); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Error("Get proxy delay of dead node:", err)
+	}
+	if delays, err := ext.GetGroupDelay(ctx, "proxy", "https://example.com", time.Second); err != nil || delays["node-b"] != 120 {
+		t.Errorf("Get group delay: %v, %v", delays, err)
+	}
+	if rules, err := ext.GetRules(ctx); err != nil || len(rules) != 1 || rules[0].Proxy != "proxy" {
+		t.Errorf("Get rules: %v, %v", rules, err)
+	}
+	if err := ext.PatchConfigs(ctx, map[string]interface{}{"mode": "global"}); err != nil {
+		t.Fatal("Patch configs failed:", err)
+	}
+	if configs, err := ext.GetConfigs(ctx); err != nil || configs.Mode != "global" {
+		t.Errorf("Get configs: %+v, %v", configs, err)
+	}
+	if _, err := ext.GetProxyProviders(ctx); err != nil {
+		t.Error("Get proxy providers:", err)
+	}
+}
+
+func TestListenLogs(t *testing.T) {
+	server := startServer(t, goxfree.MODE_CORE)
+	core := goxfree.NewCore(server.Option(t.TempDir()))
+	if err := core.Run(); err != nil {
+		t.Fatal("Run failed:", err)
+	}
+	defer core.Quit()
+
+	entries := make(chan goxfree.LogEntry, 1)
+	sub := core.ListenLogs(goxfree.LevelWarn, func(entry goxfree.LogEntry) {
+		entries <- entry
+	})
+	defer sub.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.WaitListeners(ctx, goxfreetest.STREAM_LOGS, 1); err != nil {
+		t.Fatal("Wait listener failed:", err)
+	}
+	server.PushLog("warning", "dial tcp timeout")
+	select {
+	case entry := <-entries:
+		if entry.Level != goxfree.LevelWarn || entry.Payload != "dial tcp timeout" || entry.Time.IsZero() {
+			t.Errorf("Log entry: %+v", entry)
+		}
+	case <-ctx.Done():
+		t.Fatal("Wait log timeout")
+	}
+
+	if err := core.ChangeLogLevel(goxfree.LevelDebug); err != nil {
+		t.Fatal("Change log level failed:", err)
+	}
+	if level := server.Configs()["log-level"]; level != "debug" {
+		t.Error("Log level:", level)
+	}
+}
@@ -0,0 +1,52 @@
+package goxfree
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	goxfree "github.com/niubirbang/go-xfree"
+	"github.com/niubirbang/go-xfree/goxfreetest"
+)
+
+func TestInstanceLock(t *testing.T) {
+	option := fakeOption(t, goxfreetest.Script{
+		Behavior: goxfreetest.BEHAVIOR_SUCCESS,
+	})
+	core := goxfree.NewCore(option)
+	if err := core.Run(); err != nil {
+		t.Fatal("Run failed:", err)
+	}
+
+	pidPath := filepath.Join(option.GetDir(), "xfree.pid")
+	body, err := os.ReadFile(pidPath)
+	if err != nil {
+		t.Fatal("Read pid file failed:", err)
+	}
+	if want := fmt.Sprintf("%d\n%s\n", os.Getpid(), option.GetServerUnixAddress()); string(body) != want {
+		t.Errorf("Pid file: %q", body)
+	}
+
+	err = goxfree.NewCore(option).Run()
+	var runningErr *goxfree.AlreadyRunningError
+	if !errors.Is(err, goxfree.ErrAlreadyRunning) || !errors.As(err, &runningErr) {
+		t.Fatal("Second run:", err)
+	}
+	if runningErr.PID != os.Getpid() || runningErr.Address != option.GetServerUnixAddress() {
+		t.Errorf("Already running: %+v", runningErr)
+	}
+
+	if err := core.Quit(); err != nil {
+		t.Fatal("Quit failed:", err)
+	}
+	if _, err := os.Stat(pidPath); !os.IsNotExist(err) {
+		t.Error("Pid file after quit:", err)
+	}
+	second := goxfree.NewCore(option)
+	if err := second.Run(); err != nil {
+		t.Fatal("Run after quit failed:", err)
+	}
+	second.Quit()
+}
@@ -0,0 +1,119 @@
+package goxfree
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	goxfree "github.com/niubirbang/go-xfree"
+	"github.com/niubirbang/go-xfree/goxfreetest"
+)
+
+// runLogs spawns the fake binary printing lines and waits until n lines
+// reached the process logs.
+func runLogs(t *testing.T, lines []string, n int, options ...func(*goxfree.Option)) (*goxfree.Core, []goxfree.LogLine) {
+	core := goxfree.NewCore(fakeOption(t, goxfreetest.Script{
+		Behavior: goxfreetest.BEHAVIOR_SUCCESS,
+		Logs:     lines,
+	}, options...))
+	received := make(chan goxfree.LogLine, n+1)
+	cancel := core.Logs().Subscribe(func(line goxfree.LogLine) {
+		received <- line
+	})
+	defer cancel()
+	if err := core.Run(); err != nil {
+		t.Fatal("Run failed:", err)
+	}
+	t.Cleanup(func() {
+		core.Quit()
+	})
+	var got []goxfree.LogLine
+	timeout := time.After(5 * time.Second)
+	for len(got) < n {
+		select {
+		case line := <-received:
+			got = append(got, line)
+		case <-timeout:
+			t.Fatal("Wait logs timeout:", got)
+		}
+	}
+	return core, got
+}
+
+func TestProcessLogs(t *testing.T) {
+	tests := []struct {
+		line    string
+		level   goxfree.LogLevel
+		message string
+		time    string
+	}{
+		{`{"level":"error","msg":"dial failed","time":"2026-01-02T03:04:05Z"}`, goxfree.LevelError, "dial failed", "2026-01-02T03:04:05Z"},
+		{`{"level":"warn","message":"json message"}`, goxfree.LevelWarn, "json message", ""},
+		{`time="2026-01-02T03:04:05Z" level=warning msg="slow \"node\""`, goxfree.LevelWarn, `slow "node"`, "2026-01-02T03:04:05Z"},
+		{`level=debug msg=plain`, goxfree.LevelDebug, "plain", ""},
+		{`[ERR] tun failed`, goxfree.LevelError, "tun failed", ""},
+		{`[TRACE] packet`, goxfree.LevelTrace, "packet", ""},
+		{`plain line`, goxfree.LevelInfo, "plain line", ""},
+		{`{broken json`, goxfree.LevelInfo, "{broken json", ""},
+	}
+	var lines []string
+	for _, tt := range tests {
+		lines = append(lines, tt.line)
+	}
+	// the fake also logs one stderr line
+	_, got := runLogs(t, lines, len(lines)+1)
+
+	var stdout []goxfree.LogLine
+	for _, line := range got {
+		if line.Stream == "stdout" {
+			stdout = append(stdout, line)
+		}
+	}
+	if len(stdout) != len(tests) {
+		t.Fatal("Stdout lines:", stdout)
+	}
+	for i, tt := range tests {
+		line := stdout[i]
+		if line.Level != tt.level || line.Message != tt.message {
+			t.Errorf("Parse %q: %+v", tt.line, line)
+		}
+		if tt.time != "" && line.Time.Format(time.RFC3339) != tt.time {
+			t.Errorf("Parse %q time: %s", tt.line, line.Time)
+		}
+	}
+}
+
+func TestProcessLogsBuffer(t *testing.T) {
+	lines := []string{"one", "two", "three", "four"}
+	core, _ := runLogs(t, lines, len(lines)+1, goxfree.WithLogBufferSize(3))
+	if recent := core.Logs().Recent(); len(recent) != 3 {
+		t.Error("Recent:", recent)
+	}
+}
+
+func TestProcessLogsRotate(t *testing.T) {
+	var lines []string
+	for i := 0; i < 20; i++ {
+		lines = append(lines, strings.Repeat("x", 40))
+	}
+	core, _ := runLogs(t, lines, len(lines)+1, goxfree.WithLogFile("logs/xfree.log", 200, 2))
+	if err := core.Quit(); err != nil {
+		t.Fatal("Quit failed:", err)
+	}
+
+	path := filepath.Join(core.Option().GetDir(), "logs", "xfree.log")
+	for _, p := range []string{path, path + ".1", path + ".2"} {
+		fi, err := os.Stat(p)
+		if err != nil {
+			t.Fatal("Stat log file:", err)
+		}
+		if fi.Size() > 200 {
+			t.Errorf("%s has %d bytes", p, fi.Size())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("Backup beyond maxBackups:", err)
+	}
+}
@@ -0,0 +1,13 @@
+package goxfree
+
+import (
+	"os"
+	"testing"
+
+	"github.com/niubirbang/go-xfree/goxfreetest"
+)
+
+func TestMain(m *testing.M) {
+	goxfreetest.Main()
+	os.Exit(m.Run())
+}
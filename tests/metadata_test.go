@@ -0,0 +1,58 @@
+package goxfree
+
+import (
+	"encoding/json"
+	"testing"
+
+	goxfree "github.com/niubirbang/go-xfree"
+)
+
+func TestConnectionMetadata(t *testing.T) {
+	raw := `{
+		"id": "a",
+		"chains": ["node-a", "proxy"],
+		"metadata": {
+			"network": "tcp",
+			"type": "Tun",
+			"sourceIP": "198.18.0.1",
+			"destinationIP": "1.1.1.1",
+			"sourcePort": "53211",
+			"destinationPort": 443,
+			"host": "example.com",
+			"destinationGeoIP": "US",
+			"uid": 1000,
+			"processPath": "/usr/bin/curl",
+			"dscp": "bad",
+			"newField": {"x": 1}
+		}
+	}`
+	var conn goxfree.Connection
+	if err := json.Unmarshal([]byte(raw), &conn); err != nil {
+		t.Fatal("Unmarshal failed:", err)
+	}
+	m := conn.Metadata
+	if m.Network != "tcp" || m.SourcePort != 53211 || m.DestinationPort != 443 || m.Host != "example.com" || m.UID != 1000 {
+		t.Errorf("Metadata: %+v", m)
+	}
+	if len(m.DestinationGeoIP) != 1 || m.DestinationGeoIP[0] != "US" {
+		t.Error("Destination geoip:", m.DestinationGeoIP)
+	}
+	if len(conn.Chains) != 2 || conn.Chains[0] != "node-a" {
+		t.Error("Chains:", conn.Chains)
+	}
+	if m.Extras["dscp"] != "bad" || m.Extras["newField"] == nil {
+		t.Error("Extras:", m.Extras)
+	}
+
+	body, err := json.Marshal(conn)
+	if err != nil {
+		t.Fatal("Marshal failed:", err)
+	}
+	var again goxfree.Connection
+	if err := json.Unmarshal(body, &again); err != nil {
+		t.Fatal("Unmarshal again failed:", err)
+	}
+	if again.Metadata.SourcePort != 53211 || again.Metadata.Extras["newField"] == nil {
+		t.Errorf("Round trip: %+v", again.Metadata)
+	}
+}
@@ -0,0 +1,93 @@
+//go:build linux
+// +build linux
+
+package goxfree
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	goxfree "github.com/niubirbang/go-xfree"
+	"github.com/niubirbang/go-xfree/goxfreetest"
+)
+
+// spawnOrphan starts a fake xfree for address through a shell that exits
+// right away, leaving it to init.
+func spawnOrphan(t *testing.T, env []string, cmdPath, address string) int {
+	t.Helper()
+	cmd := exec.Command("sh", "-c", `"$0" crun --unix "$1" >/dev/null 2>&1 & echo $!`, cmdPath, address)
+	cmd.Env = append(os.Environ(), env...)
+	output, err := cmd.Output()
+	if err != nil {
+		t.Fatal("Spawn orphan failed:", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(output)))
+	if err != nil {
+		t.Fatal("Orphan pid:", err)
+	}
+	t.Cleanup(func() {
+		syscall.Kill(pid, syscall.SIGKILL)
+	})
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		cmdline, _ := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+		if strings.HasPrefix(string(cmdline), cmdPath+"\x00") {
+			return pid
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Orphan not started:", string(cmdline))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// processGone reports whether pid exited, a zombie counts as exited.
+func processGone(pid int) bool {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return true
+	}
+	i := strings.LastIndexByte(string(stat), ')')
+	return i >= 0 && strings.HasPrefix(string(stat[i+1:]), " Z")
+}
+
+func TestReapOrphans(t *testing.T) {
+	option := fakeOption(t, goxfreetest.Script{
+		Behavior: goxfreetest.BEHAVIOR_SUCCESS,
+	}, goxfree.WithQuitTimeout(time.Second))
+	dir := option.GetDir()
+	address := option.GetServerUnixAddress()
+	orphan := spawnOrphan(t, option.GetCmdEnv(), option.GetCmdPath(), address)
+	// another address, or another binary on the same address, is not ours
+	other := spawnOrphan(t, option.GetCmdEnv(), option.GetCmdPath(), filepath.Join(dir, "other.sock"))
+	link := filepath.Join(dir, "xfree")
+	if err := os.Symlink(option.GetCmdPath(), link); err != nil {
+		t.Fatal("Link binary failed:", err)
+	}
+	hang := goxfree.NewOption(dir, goxfreetest.FakeBinary(goxfreetest.Script{
+		Behavior: goxfreetest.BEHAVIOR_HANG,
+	}))
+	foreign := spawnOrphan(t, hang.GetCmdEnv(), link, address)
+
+	core := goxfree.NewCore(option)
+	if err := core.Run(); err != nil {
+		t.Fatal("Run over an orphan failed:", err)
+	}
+	defer core.Quit()
+	if !processGone(orphan) {
+		t.Error("Orphan not reaped:", orphan)
+	}
+	if processGone(other) {
+		t.Error("Orphan on another address reaped:", other)
+	}
+	if processGone(foreign) {
+		t.Error("Orphan of another binary reaped:", foreign)
+	}
+}
@@ -0,0 +1,80 @@
+package goxfree
+
+import (
+	"net/netip"
+	"testing"
+
+	goxfree "github.com/niubirbang/go-xfree"
+)
+
+func TestExplainRoute(t *testing.T) {
+	server := startServer(t, goxfree.MODE_CORE)
+	server.SetProxies(
+		goxfree.Proxy{Name: "DIRECT", Type: "Direct"},
+		goxfree.Proxy{Name: "node-a", Type: "Shadowsocks"},
+		goxfree.Proxy{Name: "auto", Type: "URLTest", Now: "node-a", All: []string{"node-a"}},
+		goxfree.Proxy{Name: "proxy", Type: "Selector", Now: "auto", All: []string{"auto", "DIRECT"}},
+		goxfree.Proxy{Name: "GLOBAL", Type: "Selector", Now: "proxy", All: []string{"proxy", "DIRECT"}},
+	)
+	server.SetRules(
+		goxfree.Rule{Type: "DomainSuffix", Payload: "cn", Proxy: "DIRECT"},
+		goxfree.Rule{Type: "DomainKeyword", Payload: "google", Proxy: "proxy", Extra: &goxfree.RuleExtra{HitCount: 3}},
+		goxfree.Rule{Type: "IPCIDR", Payload: "10.0.0.0/8", Proxy: "DIRECT"},
+		goxfree.Rule{Type: "GeoSite", Payload: "youtube", Proxy: "proxy"},
+		goxfree.Rule{Type: "Match", Proxy: "proxy"},
+	)
+	core := goxfree.NewCore(server.Option(t.TempDir()))
+	if err := core.Run(); err != nil {
+		t.Fatal("Run failed:", err)
+	}
+	defer core.Quit()
+
+	rules, err := core.GetRules()
+	if err != nil || len(rules) != 5 || rules[1].Extra == nil || rules[1].Extra.HitCount != 3 {
+		t.Fatalf("Get rules: %+v, %v", rules, err)
+	}
+
+	route, err := core.ExplainRoute("www.google.com")
+	if err != nil {
+		t.Fatal("Explain route failed:", err)
+	}
+	if route.Mode != goxfree.ENGINE_MODE_RULE || !route.Matched || route.Uncertain || route.Rule.Type != "DomainKeyword" || route.Outbound != "node-a" || len(route.Chain) != 3 {
+		t.Errorf("Route: %+v", route)
+	}
+
+	if route, _ := core.ExplainRoute("baidu.cn"); route.Outbound != "DIRECT" {
+		t.Errorf("Route: %+v", route)
+	}
+	if route, _ := core.ExplainRoute("10.1.2.3"); route.Rule.Type != "IPCIDR" || route.Outbound != "DIRECT" {
+		t.Errorf("Route: %+v", route)
+	}
+	// an unresolved host stops at the first ip rule
+	route, _ = core.ExplainRoute("www.youtube.com")
+	if route.Matched || !route.Uncertain || route.Rule.Type != "IPCIDR" || route.Outbound != "" {
+		t.Errorf("Route: %+v", route)
+	}
+	route, _ = core.ExplainResolvedRoute("www.youtube.com", netip.MustParseAddr("142.250.0.1"))
+	if route.Matched || !route.Uncertain || route.Rule.Type != "GeoSite" {
+		t.Errorf("Resolved route: %+v", route)
+	}
+	route, _ = core.ExplainResolvedRoute("intranet.example", netip.MustParseAddr("10.0.0.5"))
+	if !route.Matched || route.Rule.Type != "IPCIDR" || route.Outbound != "DIRECT" {
+		t.Errorf("Resolved route: %+v", route)
+	}
+
+	// no rule is consulted outside rule mode
+	if err := core.ChangeProxyMode(goxfree.MODE_GLOBAL); err != nil {
+		t.Fatal("Change proxy mode failed:", err)
+	}
+	route, _ = core.ExplainRoute("baidu.cn")
+	if route.Mode != goxfree.ENGINE_MODE_GLOBAL || route.Matched || route.Rule.Type != "" || route.Outbound != "node-a" || len(route.Chain) != 4 {
+		t.Errorf("Global route: %+v", route)
+	}
+	if err := core.UpdateRuntimeConfig(goxfree.RuntimeConfig{Extra: map[string]interface{}{"mode": "direct"}}); err != nil {
+		t.Fatal("Update runtime config failed:", err)
+	}
+	route, _ = core.ExplainRoute("www.google.com")
+	if route.Mode != goxfree.ENGINE_MODE_DIRECT || route.Matched || route.Outbound != "DIRECT" {
+		t.Errorf("Direct route: %+v", route)
+	}
+}
@@ -0,0 +1,88 @@
+package goxfree
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+
+	goxfree "github.com/niubirbang/go-xfree"
+	"github.com/niubirbang/go-xfree/goxfreetest"
+)
+
+func TestUpdateRuntimeConfig(t *testing.T) {
+	server := startServer(t, goxfree.MODE_MANAGER)
+	manager := goxfree.NewManager(server.Option(t.TempDir()))
+	if err := manager.Run(); err != nil {
+		t.Fatal("Run failed:", err)
+	}
+	defer manager.Quit()
+
+	port, allowLan := 23456, true
+	err := manager.UpdateRuntimeConfig(goxfree.RuntimeConfig{
+		MixedPort: &port,
+		AllowLan:  &allowLan,
+		Extra:     map[string]interface{}{"unified-delay": true},
+	})
+	if err != nil {
+		t.Fatal("Update runtime config failed:", err)
+	}
+	configs := server.Configs()
+	if configs["mixed-port"] != float64(port) || configs["allow-lan"] != true || configs["unified-delay"] != true {
+		t.Error("Configs:", configs)
+	}
+	if got := manager.Option().GetMixedPort(); got != port {
+		t.Error("Option mixed port:", got)
+	}
+
+	if err := manager.ChangeLogLevel(goxfree.LevelError); err != nil {
+		t.Fatal("Change log level failed:", err)
+	}
+	if got := manager.Option().GetLogLevel(); got != goxfree.LevelError {
+		t.Error("Option log level:", got)
+	}
+	if level := server.Configs()["log-level"]; level != "error" {
+		t.Error("Log level:", level)
+	}
+
+	server.Fail("/configs", goxfreetest.Failure{StatusCode: http.StatusBadRequest, Message: "bad config"})
+	if err := manager.UpdateRuntimeConfig(goxfree.RuntimeConfig{MixedPort: new(int)}); err == nil {
+		t.Fatal("Update against a failing controller succeeded")
+	}
+	if got := manager.Option().GetMixedPort(); got != port {
+		t.Error("Option changed by a failed update:", got)
+	}
+}
+
+func TestUpdateRuntimeConfigConcurrent(t *testing.T) {
+	server := startServer(t, goxfree.MODE_CORE)
+	server.SetDNS("example.com", goxfree.DNSAnswer{Name: "example.com.", Type: 1, Data: "1.1.1.1"})
+	core := goxfree.NewCore(server.Option(t.TempDir()))
+	if err := core.Run(); err != nil {
+		t.Fatal("Run failed:", err)
+	}
+	defer core.Quit()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			port := 20000 + i
+			if err := core.UpdateRuntimeConfig(goxfree.RuntimeConfig{MixedPort: &port}); err != nil {
+				t.Error("Update runtime config failed:", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := core.ResolveDNS(context.Background(), "example.com", "A"); err != nil {
+				t.Error("Resolve failed:", err)
+			}
+			core.Option()
+		}()
+	}
+	wg.Wait()
+	if got, want := core.Option().GetMixedPort(), server.Configs()["mixed-port"]; float64(got) != want {
+		t.Errorf("Option mixed port %d, engine %v", got, want)
+	}
+}
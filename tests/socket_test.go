@@ -0,0 +1,58 @@
+//go:build !windows
+// +build !windows
+
+package goxfree
+
+import (
+	"errors"
+	"net"
+	"os"
+	"testing"
+
+	goxfree "github.com/niubirbang/go-xfree"
+	"github.com/niubirbang/go-xfree/goxfreetest"
+)
+
+func TestStaleSocket(t *testing.T) {
+	option := fakeOption(t, goxfreetest.Script{
+		Behavior: goxfreetest.BEHAVIOR_SUCCESS,
+	})
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: option.GetServerUnixAddress(), Net: "unix"})
+	if err != nil {
+		t.Fatal("Listen failed:", err)
+	}
+	listener.SetUnlinkOnClose(false)
+	listener.Close()
+	if _, err := os.Lstat(option.GetServerUnixAddress()); err != nil {
+		t.Fatal("Stale socket missing:", err)
+	}
+
+	core := goxfree.NewCore(option)
+	if err := core.Run(); err != nil {
+		t.Fatal("Run over stale socket failed:", err)
+	}
+	core.Quit()
+}
+
+func TestLiveSocket(t *testing.T) {
+	option := fakeOption(t, goxfreetest.Script{
+		Behavior: goxfreetest.BEHAVIOR_SUCCESS,
+	})
+	listener, err := net.Listen("unix", option.GetServerUnixAddress())
+	if err != nil {
+		t.Fatal("Listen failed:", err)
+	}
+	defer listener.Close()
+
+	err = goxfree.NewCore(option).Run()
+	var runningErr *goxfree.AlreadyRunningError
+	if !errors.Is(err, goxfree.ErrAlreadyRunning) || !errors.As(err, &runningErr) {
+		t.Fatal("Run over live socket:", err)
+	}
+	if runningErr.PID != os.Getpid() || runningErr.Address != option.GetServerUnixAddress() {
+		t.Errorf("Already running: %+v", runningErr)
+	}
+	if _, err := os.Lstat(option.GetServerUnixAddress()); err != nil {
+		t.Error("Live socket removed:", err)
+	}
+}
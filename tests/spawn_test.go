@@ -0,0 +1,214 @@
+package goxfree
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	goxfree "github.com/niubirbang/go-xfree"
+	"github.com/niubirbang/go-xfree/goxfreetest"
+)
+
+func fakeOption(t *testing.T, script goxfreetest.Script, options ...func(*goxfree.Option)) goxfree.Option {
+	dir := t.TempDir()
+	option := goxfree.NewOption(
+		dir,
+		goxfreetest.FakeBinary(script),
+		goxfree.WithServerUnixAddress(filepath.Join(dir, "xfree.sock")),
+		goxfree.WithReadyInterval(50*time.Millisecond),
+	)
+	for _, o := range options {
+		o(&option)
+	}
+	return option
+}
+
+func TestSpawnSuccess(t *testing.T) {
+	var stages []goxfree.Stage
+	core := goxfree.NewCore(fakeOption(t, goxfreetest.Script{
+		Behavior: goxfreetest.BEHAVIOR_SUCCESS,
+		Progress: []string{"tun"},
+	}, goxfree.WithOnStage(func(stage goxfree.Stage) {
+		stages = append(stages, stage)
+	})))
+	if err := core.Run(); err != nil {
+		t.Fatal("Run failed:", err)
+	}
+	if _, err := core.GetStore(); err != nil {
+		t.Error("Get store failed:", err)
+	}
+	if err := core.Quit(); err != nil {
+		t.Fatal("Quit failed:", err)
+	}
+	<-core.Done()
+	if err := core.Err(); err != nil {
+		t.Error("Err after quit:", err)
+	}
+	want := []goxfree.Stage{goxfree.STAGE_SPAWN, "tun", goxfree.STAGE_CONNECT, goxfree.STAGE_READY}
+	if len(stages) != len(want) {
+		t.Fatal("Stages:", stages)
+	}
+	for i := range want {
+		if stages[i] != want[i] {
+			t.Fatal("Stages:", stages)
+		}
+	}
+}
+
+func TestSpawnError(t *testing.T) {
+	core := goxfree.NewCore(fakeOption(t, goxfreetest.Script{
+		Behavior: goxfreetest.BEHAVIOR_ERROR,
+		Message:  "bad config",
+	}))
+	err := core.Run()
+	var startupErr *goxfree.StartupError
+	if !errors.As(err, &startupErr) || startupErr.Err.Error() != "bad config" {
+		t.Fatal("Run error:", err)
+	}
+}
+
+func TestSpawnErrorLinger(t *testing.T) {
+	core := goxfree.NewCore(fakeOption(t, goxfreetest.Script{
+		Behavior: goxfreetest.BEHAVIOR_ERROR,
+		Message:  "bad config",
+		Linger:   true,
+	}, goxfree.WithQuitTimeout(time.Second)))
+	for i := 0; i < 2; i++ {
+		err := core.Run()
+		var startupErr *goxfree.StartupError
+		if !errors.As(err, &startupErr) || errors.Is(err, goxfree.ErrAlreadyRunning) {
+			t.Fatalf("Run %d error: %v", i, err)
+		}
+	}
+}
+
+func TestSpawnTimeout(t *testing.T) {
+	core := goxfree.NewCore(fakeOption(t, goxfreetest.Script{
+		Behavior: goxfreetest.BEHAVIOR_HANG,
+		Progress: []string{"tun"},
+	}, goxfree.WithStartTimeout(300*time.Millisecond)))
+	err := core.Run()
+	var startupErr *goxfree.StartupError
+	if !errors.Is(err, goxfree.ErrStartupTimeout) || !errors.As(err, &startupErr) || startupErr.Stage != "tun" {
+		t.Fatal("Run error:", err)
+	}
+}
+
+func TestSpawnCrash(t *testing.T) {
+	exits := make(chan goxfree.ProcessExit, 4)
+	core := goxfree.NewCore(fakeOption(t, goxfreetest.Script{
+		Behavior:   goxfreetest.BEHAVIOR_CRASH,
+		ExitCode:   3,
+		CrashAfter: 100 * time.Millisecond,
+	}, goxfree.WithRestartPolicy(goxfree.RestartPolicy{
+		MaxRestarts: 1,
+		Backoff:     10 * time.Millisecond,
+	}), goxfree.WithOnExit(func(exit goxfree.ProcessExit) {
+		exits <- exit
+	})))
+	if err := core.Run(); err != nil {
+		t.Fatal("Run failed:", err)
+	}
+	defer core.Quit()
+
+	select {
+	case <-core.Done():
+	case <-time.After(10 * time.Second):
+		t.Fatal("Done not closed after crash")
+	}
+	var exitErr *goxfree.ExitError
+	if !errors.As(core.Err(), &exitErr) || exitErr.Code != 3 {
+		t.Fatal("Err:", core.Err())
+	}
+	if first, second := <-exits, <-exits; first.Attempt != 1 || second.Attempt != 0 {
+		t.Error("Exits:", first, second)
+	}
+}
+
+func TestSpawnIgnoreTerm(t *testing.T) {
+	core := goxfree.NewCore(fakeOption(t, goxfreetest.Script{
+		Behavior: goxfreetest.BEHAVIOR_IGNORE_TERM,
+	}, goxfree.WithQuitTimeout(200*time.Millisecond)))
+	if err := core.Run(); err != nil {
+		t.Fatal("Run failed:", err)
+	}
+	start := time.Now()
+	if err := core.Quit(); err != nil {
+		t.Fatal("Quit failed:", err)
+	}
+	if err := core.Run(); err != nil {
+		t.Fatal("Run after quit failed:", err)
+	}
+	core.Quit()
+	if d := time.Since(start); d > 5*time.Second {
+		t.Error("Quit took:", d)
+	}
+}
+
+func TestSpawnConnectTimeout(t *testing.T) {
+	option := fakeOption(t, goxfreetest.Script{
+		Behavior: goxfreetest.BEHAVIOR_SUCCESS,
+		Unready:  time.Second,
+	}, goxfree.WithReadyTimeout(200*time.Millisecond))
+	core := goxfree.NewCore(option)
+	var startupErr *goxfree.StartupError
+	if err := core.Run(); !errors.As(err, &startupErr) || startupErr.Stage != goxfree.STAGE_CONNECT || !errors.Is(err, goxfree.ErrStartupTimeout) {
+		t.Fatal("Run error:", err)
+	}
+	if _, err := core.GetStore(); !errors.Is(err, goxfree.ErrNotRunning) {
+		t.Error("Core still answers after a failed start:", err)
+	}
+
+	goxfree.WithReadyTimeout(5 * time.Second)(&option)
+	core = goxfree.NewCore(option)
+	if err := core.Run(); err != nil {
+		t.Fatal("Run after connect timeout failed:", err)
+	}
+	core.Quit()
+}
+
+func TestSpawnRestore(t *testing.T) {
+	exits := make(chan goxfree.ProcessExit, 4)
+	manager := goxfree.NewManager(fakeOption(t, goxfreetest.Script{
+		Behavior:   goxfreetest.BEHAVIOR_CRASH,
+		ExitCode:   3,
+		CrashAfter: 2 * time.Second,
+	}, goxfree.WithRestartPolicy(goxfree.RestartPolicy{
+		MaxRestarts: 1,
+		Backoff:     10 * time.Millisecond,
+	}), goxfree.WithOnExit(func(exit goxfree.ProcessExit) {
+		exits <- exit
+	})))
+	if err := manager.Run(); err != nil {
+		t.Fatal("Run failed:", err)
+	}
+	defer manager.Quit()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	events := manager.Events(ctx)
+
+	if err := manager.ChangeNetMode(goxfree.MODE_TUN); err != nil {
+		t.Fatal("Change net mode failed:", err)
+	}
+	if err := manager.ChangeProxyMode(goxfree.MODE_GLOBAL); err != nil {
+		t.Fatal("Change proxy mode failed:", err)
+	}
+	if err := manager.ChangeNodeFixed(goxfree.Chain{"sub", "node-b"}); err != nil {
+		t.Fatal("Change node fixed failed:", err)
+	}
+
+	if exit := <-exits; exit.Attempt != 1 {
+		t.Fatal("Exit:", exit)
+	}
+	nextEvent(t, events, goxfree.EVENT_STARTED)
+	store, err := manager.GetStore()
+	if err != nil {
+		t.Fatal("Get store after restart failed:", err)
+	}
+	if store.NetMode != goxfree.MODE_TUN || store.ProxyMode != goxfree.MODE_GLOBAL ||
+		store.CurrentMode != goxfree.CURRENT_MODE_FIXED || store.Current != "node-b" {
+		t.Errorf("Store after restart: %+v", store)
+	}
+}
@@ -0,0 +1,100 @@
+package goxfree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	goxfree "github.com/niubirbang/go-xfree"
+	"github.com/niubirbang/go-xfree/goxfreetest"
+)
+
+func TestSubscription(t *testing.T) {
+	server := startServer(t, goxfree.MODE_CORE)
+	core := goxfree.NewCore(server.Option(t.TempDir()))
+	if err := core.Run(); err != nil {
+		t.Fatal("Run failed:", err)
+	}
+
+	traffics := make(chan goxfree.Traffic, 1)
+	sub := core.ListenTraffic(func(traffic goxfree.Traffic) {
+		traffics <- traffic
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.WaitListeners(ctx, goxfreetest.STREAM_TRAFFIC, 1); err != nil {
+		t.Fatal("Wait listener failed:", err)
+	}
+	server.PushTraffic(goxfree.Traffic{Up: 1, Down: 2})
+	if traffic := <-traffics; traffic.Down != 2 {
+		t.Error("Listen traffic:", traffic)
+	}
+
+	sub.Close()
+	<-sub.Done()
+	if !errors.Is(sub.Err(), goxfree.ErrSubscriptionClosed) {
+		t.Error("Err after close:", sub.Err())
+	}
+
+	memerySub := core.ListenMemery(func(goxfree.Memery) {})
+	if err := server.WaitListeners(ctx, goxfreetest.STREAM_MEMERY, 1); err != nil {
+		t.Fatal("Wait listener failed:", err)
+	}
+	core.Quit()
+	select {
+	case <-memerySub.Done():
+	case <-ctx.Done():
+		t.Fatal("Subscription still running after quit")
+	}
+}
+
+func TestReconnectPolicy(t *testing.T) {
+	server := startServer(t, goxfree.MODE_CORE)
+	states := make(chan goxfree.StreamState, 16)
+	core := goxfree.NewCore(server.Option(t.TempDir(),
+		goxfree.WithReconnectPolicy(goxfree.ReconnectPolicy{
+			MaxAttempts: 2,
+			Backoff:     10 * time.Millisecond,
+			Jitter:      -1,
+		}),
+		goxfree.WithOnStreamState(func(state goxfree.StreamState) {
+			states <- state
+		}),
+	))
+	if err := core.Run(); err != nil {
+		t.Fatal("Run failed:", err)
+	}
+	defer core.Quit()
+
+	sub := core.ListenDelay(func(map[string]int) {})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.WaitListeners(ctx, goxfreetest.STREAM_DELAY, 1); err != nil {
+		t.Fatal("Wait listener failed:", err)
+	}
+	server.Close()
+
+	select {
+	case <-sub.Done():
+	case <-ctx.Done():
+		t.Fatal("Subscription still running without server")
+	}
+	if !errors.Is(sub.Err(), goxfree.ErrStreamUnavailable) {
+		t.Error("Err after giving up:", sub.Err())
+	}
+
+	var statuses []goxfree.StreamStatus
+	for len(states) > 0 {
+		statuses = append(statuses, (<-states).Status)
+	}
+	want := []goxfree.StreamStatus{
+		goxfree.STREAM_CONNECTING, goxfree.STREAM_CONNECTED, goxfree.STREAM_DISCONNECTED,
+		goxfree.STREAM_CONNECTING, goxfree.STREAM_DISCONNECTED,
+		goxfree.STREAM_CONNECTING, goxfree.STREAM_DISCONNECTED,
+	}
+	if fmt.Sprint(statuses) != fmt.Sprint(want) {
+		t.Error("Stream states:", statuses)
+	}
+}
@@ -0,0 +1,113 @@
+package goxfree
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	goxfree "github.com/niubirbang/go-xfree"
+	"github.com/niubirbang/go-xfree/goxfreetest"
+)
+
+func TestTrafficMeter(t *testing.T) {
+	server := startServer(t, goxfree.MODE_CORE)
+	core := goxfree.NewCore(server.Option(t.TempDir()))
+	if err := core.Run(); err != nil {
+		t.Fatal("Run failed:", err)
+	}
+	defer core.Quit()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	meter := goxfree.NewTrafficMeter(ctx, core, 2, 0)
+	if err := server.WaitListeners(ctx, goxfreetest.STREAM_TRAFFIC, 1); err != nil {
+		t.Fatal("Wait listener failed:", err)
+	}
+	// samples 200ms apart, the first one counts as a full second
+	start := time.Now()
+	for i, traffic := range []goxfree.Traffic{{Up: 10, Down: 100}, {Up: 30, Down: 50}, {Up: 20, Down: 0}} {
+		if i > 0 {
+			time.Sleep(200 * time.Millisecond)
+		}
+		server.PushTraffic(traffic)
+	}
+	for {
+		if seconds := meter.Seconds(); len(seconds) == 2 && seconds[1].Up == 20 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatal("Wait traffic timeout:", meter.Stats())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	span := time.Since(start).Seconds()
+
+	stats := meter.Stats()
+	if stats.UpTotal <= 10 || float64(stats.UpTotal) > 10+50*span {
+		t.Errorf("Up total over %.2fs: %+v", span, stats)
+	}
+	if stats.DownTotal <= 100 || float64(stats.DownTotal) > 100+50*span {
+		t.Errorf("Down total over %.2fs: %+v", span, stats)
+	}
+	if stats.UpPeak != 30 || stats.DownPeak != 100 {
+		t.Errorf("Stats: %+v", stats)
+	}
+	if stats.Down <= 0 || stats.Down >= 100 {
+		t.Error("Smoothed down rate:", stats.Down)
+	}
+	if seconds := meter.Seconds(); len(seconds) != 2 || seconds[1].Up != 20 {
+		t.Error("Seconds:", seconds)
+	}
+	if minutes := meter.Minutes(); len(minutes) == 0 {
+		t.Error("Minutes empty")
+	}
+
+	meter.Close()
+	<-meter.Done()
+	if meter.Stats().UpTotal != stats.UpTotal {
+		t.Error("Stats lost after close")
+	}
+}
+
+func TestTrafficMeterGap(t *testing.T) {
+	server := startServer(t, goxfree.MODE_CORE)
+	core := goxfree.NewCore(server.Option(t.TempDir()))
+	if err := core.Run(); err != nil {
+		t.Fatal("Run failed:", err)
+	}
+	defer core.Quit()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	meter := goxfree.NewTrafficMeter(ctx, core, 0, 0)
+	defer meter.Close()
+	if err := server.WaitListeners(ctx, goxfreetest.STREAM_TRAFFIC, 1); err != nil {
+		t.Fatal("Wait listener failed:", err)
+	}
+	// the stream drops and nothing is measured for a while
+	server.PushTraffic(goxfree.Traffic{Up: 10})
+	for meter.Stats().UpTotal < 10 {
+		select {
+		case <-ctx.Done():
+			t.Fatal("Wait traffic timeout:", meter.Stats())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	server.Disconnect(goxfreetest.STREAM_TRAFFIC)
+	time.Sleep(2500 * time.Millisecond)
+	if err := server.WaitListeners(ctx, goxfreetest.STREAM_TRAFFIC, 1); err != nil {
+		t.Fatal("Wait reconnect failed:", err)
+	}
+	server.PushTraffic(goxfree.Traffic{Up: 100})
+	for meter.Stats().UpTotal <= 10 {
+		select {
+		case <-ctx.Done():
+			t.Fatal("Wait traffic timeout:", meter.Stats())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if stats := meter.Stats(); stats.UpTotal != 110 {
+		t.Errorf("Up total after a gap: %+v", stats)
+	}
+}
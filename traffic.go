@@ -0,0 +1,217 @@
+package goxfree
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+var (
+	defaultTrafficSecondHistory = 300
+	defaultTrafficMinuteHistory = 60
+	// weight of the newest sample in the smoothed rate
+	trafficSmoothing = 0.3
+	// interval xfree pushes traffic at
+	trafficInterval = time.Second
+)
+
+type (
+	// TrafficSample is a rate in bytes per second at Time.
+	TrafficSample struct {
+		Time time.Time `json:"time"`
+		Up   float64   `json:"up"`
+		Down float64   `json:"down"`
+	}
+	// TrafficStats is a snapshot of a TrafficMeter.
+	TrafficStats struct {
+		Start     time.Time `json:"start"`
+		Up        float64   `json:"up"`   // smoothed bytes per second
+		Down      float64   `json:"down"` // smoothed bytes per second
+		UpTotal   int64     `json:"upTotal"`
+		DownTotal int64     `json:"downTotal"`
+		UpPeak    int       `json:"upPeak"`
+		DownPeak  int       `json:"downPeak"`
+	}
+	// TrafficMeter aggregates the traffic stream. Totals weight each sample
+	// by the time since the previous one. The first one and one following a
+	// gap, e.g. a reconnect or a restart of the core, count as the second
+	// xfree pushes at.
+	TrafficMeter struct {
+		mu      sync.Mutex
+		sub     *Subscription
+		stats   TrafficStats
+		last    time.Time // time of the previous sample
+		up      float64   // unrounded UpTotal
+		down    float64   // unrounded DownTotal
+		seconds *ring[TrafficSample]
+		minutes *ring[TrafficSample]
+		minute  TrafficSample // minute being accumulated
+		samples int           // samples in minute
+	}
+
+	ring[T any] struct {
+		buf  []T
+		next int
+		full bool
+	}
+)
+
+// NewTrafficMeter starts metering c until ctx ends or Close is called.
+// secondHistory and minuteHistory size the history buffers, <= 0 uses the
+// defaults of 300 seconds and 60 minutes.
+func NewTrafficMeter(ctx context.Context, c Controller, secondHistory, minuteHistory int) *TrafficMeter {
+	if secondHistory <= 0 {
+		secondHistory = defaultTrafficSecondHistory
+	}
+	if minuteHistory <= 0 {
+		minuteHistory = defaultTrafficMinuteHistory
+	}
+	m := &TrafficMeter{
+		stats: TrafficStats{
+			Start: time.Now(),
+		},
+		seconds: newRing[TrafficSample](secondHistory),
+		minutes: newRing[TrafficSample](minuteHistory),
+	}
+	m.sub = c.ListenTrafficContext(ctx, func(data Traffic) {
+		m.add(time.Now(), data)
+	})
+	return m
+}
+
+func (m *TrafficMeter) add(now time.Time, data Traffic) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.seconds.len() == 0 {
+		m.stats.Up, m.stats.Down = float64(data.Up), float64(data.Down)
+	} else {
+		m.stats.Up += trafficSmoothing * (float64(data.Up) - m.stats.Up)
+		m.stats.Down += trafficSmoothing * (float64(data.Down) - m.stats.Down)
+	}
+	elapsed := now.Sub(m.last)
+	if m.last.IsZero() || elapsed > 2*trafficInterval {
+		elapsed = trafficInterval
+	}
+	m.last = now
+	m.up += float64(data.Up) * elapsed.Seconds()
+	m.down += float64(data.Down) * elapsed.Seconds()
+	m.stats.UpTotal, m.stats.DownTotal = int64(m.up), int64(m.down)
+	m.stats.UpPeak = max(m.stats.UpPeak, data.Up)
+	m.stats.DownPeak = max(m.stats.DownPeak, data.Down)
+
+	m.seconds.push(TrafficSample{
+		Time: now.Truncate(time.Second),
+		Up:   float64(data.Up),
+		Down: float64(data.Down),
+	})
+
+	bucket := now.Truncate(time.Minute)
+	if m.samples > 0 && !bucket.Equal(m.minute.Time) {
+		m.flushMinute()
+	}
+	m.minute.Time = bucket
+	m.minute.Up += float64(data.Up)
+	m.minute.Down += float64(data.Down)
+	m.samples++
+}
+
+func (m *TrafficMeter) flushMinute() {
+	m.minutes.push(TrafficSample{
+		Time: m.minute.Time,
+		Up:   m.minute.Up / float64(m.samples),
+		Down: m.minute.Down / float64(m.samples),
+	})
+	m.minute = TrafficSample{}
+	m.samples = 0
+}
+
+// Stats returns totals, smoothed rates and peaks since the meter started.
+func (m *TrafficMeter) Stats() TrafficStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stats
+}
+
+// Seconds returns the per-second history, oldest first.
+func (m *TrafficMeter) Seconds() []TrafficSample {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.seconds.list()
+}
+
+// Minutes returns the average rate of each finished minute, oldest first,
+// followed by the minute in progress.
+func (m *TrafficMeter) Minutes() []TrafficSample {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	samples := m.minutes.list()
+	if m.samples > 0 {
+		samples = append(samples, TrafficSample{
+			Time: m.minute.Time,
+			Up:   m.minute.Up / float64(m.samples),
+			Down: m.minute.Down / float64(m.samples),
+		})
+	}
+	return samples
+}
+
+// Reset clears totals, peaks and history.
+func (m *TrafficMeter) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stats = TrafficStats{
+		Start: time.Now(),
+	}
+	m.last = time.Time{}
+	m.up, m.down = 0, 0
+	m.seconds = newRing[TrafficSample](len(m.seconds.buf))
+	m.minutes = newRing[TrafficSample](len(m.minutes.buf))
+	m.minute = TrafficSample{}
+	m.samples = 0
+}
+
+// Close stops metering, the collected data stays readable.
+func (m *TrafficMeter) Close() {
+	m.sub.Close()
+}
+
+// Done is closed when the meter stopped receiving samples.
+func (m *TrafficMeter) Done() <-chan struct{} {
+	return m.sub.Done()
+}
+
+func newRing[T any](size int) *ring[T] {
+	return &ring[T]{
+		buf: make([]T, size),
+	}
+}
+
+func (r *ring[T]) push(item T) {
+	if len(r.buf) == 0 {
+		return
+	}
+	r.buf[r.next] = item
+	r.next++
+	if r.next == len(r.buf) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+func (r *ring[T]) len() int {
+	if r.full {
+		return len(r.buf)
+	}
+	return r.next
+}
+
+// list returns the pushed items, oldest first
+func (r *ring[T]) list() []T {
+	if !r.full {
+		return append([]T(nil), r.buf[:r.next]...)
+	}
+	items := make([]T, 0, len(r.buf))
+	items = append(items, r.buf[r.next:]...)
+	return append(items, r.buf[:r.next]...)
+}
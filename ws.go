@@ -1,7 +1,9 @@
 package goxfree
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"net/url"
 	"strings"
@@ -13,15 +15,32 @@ type ws struct {
 	dialer *websocket.Dialer
 }
 
-func (w *ws) conn(path string) (*websocket.Conn, error) {
+func newWsTcpDialer(address string) *ws {
+	return &ws{
+		dialer: &websocket.Dialer{
+			NetDialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "tcp", address)
+			},
+		},
+	}
+}
+
+func (w *ws) conn(ctx context.Context, path string) (*websocket.Conn, error) {
 	path = strings.TrimLeft(path, "/")
-	u := url.URL{Scheme: "ws", Host: "unix", Path: fmt.Sprintf("/%s", path)}
-	conn, resp, err := w.dialer.Dial(u.String(), http.Header{})
+	path, query, _ := strings.Cut(path, "?")
+	u := url.URL{Scheme: "ws", Host: "unix", Path: fmt.Sprintf("/%s", path), RawQuery: query}
+	conn, resp, err := w.dialer.DialContext(ctx, u.String(), http.Header{})
 	if err != nil {
 		if resp != nil {
-			return nil, fmt.Errorf("ws response status: %s", resp.Status)
+			return nil, &APIError{
+				Endpoint:   u.Path,
+				Method:     http.MethodGet,
+				StatusCode: resp.StatusCode,
+				Message:    resp.Status,
+			}
 		}
-		return nil, err
+		return nil, wrapDialError(err)
 	}
 	return conn, nil
 }
@@ -7,10 +7,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
 	"net"
 	"net/http"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -18,20 +20,65 @@ import (
 	"github.com/gorilla/websocket"
 )
 
+func (c *client) setSysProcAttr(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid: true,
+	}
+}
+
 func (c *client) quit() {
 	pgid := c.cmdPgid
 	if pgid == 0 {
 		return
 	}
 	_ = syscall.Kill(-pgid, syscall.SIGTERM)
-	time.AfterFunc(5*time.Second, func() {
-		_ = syscall.Kill(-pgid, syscall.SIGKILL)
-	})
+	if c.waitExit(c.option.GetQuitTimeout()) {
+		return
+	}
+	_ = syscall.Kill(-pgid, syscall.SIGKILL)
+	if !c.waitExit(5 * time.Second) {
+		log.Println("xfree did not exit after SIGKILL, pid:", pgid)
+	}
+}
+
+func (c *client) reapOrphans() error {
+	return nil
+}
+
+// unixSocketOwner asks lsof for the process holding address, 0 when unknown.
+func unixSocketOwner(address string) int {
+	output, err := exec.Command("lsof", "-t", address).Output()
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(strings.SplitN(string(output), "\n", 2)[0]))
+	return pid
+}
+
+func lockFile(p string) (*os.File, error) {
+	file, err := os.OpenFile(p, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		file.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, errLocked
+		}
+		return nil, err
+	}
+	return file, nil
+}
+
+func unlockFile(file *os.File) {
+	_ = syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+	_ = file.Close()
 }
 
 func newHttpUnixClient(address string) *api {
 	dialer := func(ctx context.Context, network, addr string) (net.Conn, error) {
-		return net.Dial("unix", address)
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", address)
 	}
 	return &api{
 		client: &http.Client{
@@ -40,7 +87,6 @@ func newHttpUnixClient(address string) *api {
 				DisableCompression: false,
 				ForceAttemptHTTP2:  false,
 			},
-			Timeout: 5 * time.Second,
 		},
 	}
 }
@@ -49,7 +95,8 @@ func newWsUnixDialer(address string) *ws {
 	return &ws{
 		dialer: &websocket.Dialer{
 			NetDialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
-				return net.Dial("unix", address)
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", address)
 			},
 		},
 	}
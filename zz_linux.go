@@ -7,10 +7,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
 	"net"
 	"net/http"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -18,20 +20,183 @@ import (
 	"github.com/gorilla/websocket"
 )
 
+func (c *client) setSysProcAttr(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid: true,
+	}
+}
+
 func (c *client) quit() {
 	pgid := c.cmdPgid
 	if pgid == 0 {
 		return
 	}
 	_ = syscall.Kill(-pgid, syscall.SIGTERM)
-	time.AfterFunc(5*time.Second, func() {
-		_ = syscall.Kill(-pgid, syscall.SIGKILL)
-	})
+	if c.waitExit(c.option.GetQuitTimeout()) {
+		return
+	}
+	_ = syscall.Kill(-pgid, syscall.SIGKILL)
+	if !c.waitExit(5 * time.Second) {
+		log.Println("xfree did not exit after SIGKILL, pid:", pgid)
+	}
+}
+
+// reapOrphans kills xfree processes serving the same address whose parent is
+// no longer an instance of this program, e.g. after the host crashed.
+func (c *client) reapOrphans() error {
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return err
+	}
+	var pids []int
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+		if c.isOrphan(pid, self) {
+			pids = append(pids, pid)
+		}
+	}
+	for _, pid := range pids {
+		log.Println("reap stale xfree, pid:", pid)
+		_ = syscall.Kill(pid, syscall.SIGTERM)
+	}
+	deadline := time.Now().Add(c.option.GetQuitTimeout())
+	for _, pid := range pids {
+		for processAlive(pid) && time.Now().Before(deadline) {
+			time.Sleep(100 * time.Millisecond)
+		}
+		if processAlive(pid) {
+			_ = syscall.Kill(pid, syscall.SIGKILL)
+		}
+	}
+	return nil
+}
+
+func (c *client) isOrphan(pid int, self string) bool {
+	cmdline, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		return false
+	}
+	args := strings.Split(strings.TrimRight(string(cmdline), "\x00"), "\x00")
+	if len(args) < 2 || args[0] != c.cmdPath {
+		return false
+	}
+	var sameAddress bool
+	for i := 1; i < len(args)-1; i++ {
+		if args[i] == "--unix" && args[i+1] == c.option.GetServerUnixAddress() {
+			sameAddress = true
+			break
+		}
+	}
+	if !sameAddress {
+		return false
+	}
+	ppid, err := processParent(pid)
+	if err != nil || ppid == os.Getpid() {
+		return false
+	}
+	parentExe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", ppid))
+	return err != nil || parentExe != self
+}
+
+func processParent(pid int) (int, error) {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+	// the command name may contain spaces, fields start after its last ')'
+	i := strings.LastIndexByte(string(stat), ')')
+	if i < 0 {
+		return 0, errors.New("invalid stat")
+	}
+	fields := strings.Fields(string(stat[i+1:]))
+	if len(fields) < 2 {
+		return 0, errors.New("invalid stat")
+	}
+	return strconv.Atoi(fields[1])
+}
+
+func processAlive(pid int) bool {
+	return syscall.Kill(pid, 0) != syscall.ESRCH
+}
+
+// unixSocketOwner finds the process holding the listening socket bound to
+// address, 0 when it is not visible to this user.
+func unixSocketOwner(address string) int {
+	body, err := os.ReadFile("/proc/net/unix")
+	if err != nil {
+		return 0
+	}
+	// connections queued on the listener show the same path, only the
+	// listener itself carries __SO_ACCEPTCON in Flags
+	var inode string
+	for _, line := range strings.Split(string(body), "\n")[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 8 || fields[7] != address {
+			continue
+		}
+		if flags, err := strconv.ParseUint(fields[3], 16, 32); err == nil && flags&0x10000 != 0 {
+			inode = fields[6]
+			break
+		}
+	}
+	if inode == "" {
+		return 0
+	}
+	target := fmt.Sprintf("socket:[%s]", inode)
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return 0
+	}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		fdDir := fmt.Sprintf("/proc/%d/fd", pid)
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			if link, err := os.Readlink(fdDir + "/" + fd.Name()); err == nil && link == target {
+				return pid
+			}
+		}
+	}
+	return 0
+}
+
+func lockFile(p string) (*os.File, error) {
+	file, err := os.OpenFile(p, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		file.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, errLocked
+		}
+		return nil, err
+	}
+	return file, nil
+}
+
+func unlockFile(file *os.File) {
+	_ = syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+	_ = file.Close()
 }
 
 func newHttpUnixClient(address string) *api {
 	dialer := func(ctx context.Context, network, addr string) (net.Conn, error) {
-		return net.Dial("unix", address)
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", address)
 	}
 	return &api{
 		client: &http.Client{
@@ -40,7 +205,6 @@ func newHttpUnixClient(address string) *api {
 				DisableCompression: false,
 				ForceAttemptHTTP2:  false,
 			},
-			Timeout: 5 * time.Second,
 		},
 	}
 }
@@ -49,7 +213,8 @@ func newWsUnixDialer(address string) *ws {
 	return &ws{
 		dialer: &websocket.Dialer{
 			NetDialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
-				return net.Dial("unix", address)
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", address)
 			},
 		},
 	}
@@ -0,0 +1,49 @@
+//go:build !windows
+// +build !windows
+
+package goxfree
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+// checkSocket removes a socket file nobody listens on and refuses to start
+// over one that is still served.
+func (c *client) checkSocket() error {
+	address := c.option.GetServerUnixAddress()
+	if address == "" {
+		return nil
+	}
+	fi, err := os.Lstat(address)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", address)
+	}
+	conn, err := net.DialTimeout("unix", address, time.Second)
+	if err == nil {
+		conn.Close()
+		return &AlreadyRunningError{
+			PID:     unixSocketOwner(address),
+			Address: address,
+		}
+	}
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		return err
+	}
+	if err := os.Remove(address); err != nil {
+		// e.g. a root owned socket in sticky /tmp, the core replaces it itself
+		log.Println("remove stale socket failed:", err)
+	}
+	return nil
+}
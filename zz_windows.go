@@ -11,12 +11,16 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"syscall"
 	"time"
 
 	"github.com/Microsoft/go-winio"
 	"github.com/gorilla/websocket"
 )
 
+func (c *client) setSysProcAttr(cmd *exec.Cmd) {
+}
+
 func (c *client) quit() {
 	pgid := c.cmdPgid
 	if pgid == 0 {
@@ -29,18 +33,69 @@ func (c *client) quit() {
 	if err := proc.Kill(); err != nil {
 		return
 	}
+	c.waitExit(c.option.GetQuitTimeout())
+}
+
+func (c *client) reapOrphans() error {
+	return nil
+}
+
+const errorSharingViolation syscall.Errno = 32
+
+// named pipes vanish with their server, only a live one is reported
+func (c *client) checkSocket() error {
+	address := c.option.GetServerUnixAddress()
+	if address == "" {
+		return nil
+	}
+	timeout := time.Second
+	conn, err := winio.DialPipe(address, &timeout)
+	if err != nil {
+		return nil
+	}
+	conn.Close()
+	return &AlreadyRunningError{
+		Address: address,
+	}
+}
+
+// the lock file is opened without sharing, a second open fails until the
+// owner closes it or exits
+func lockFile(p string) (*os.File, error) {
+	name, err := syscall.UTF16PtrFromString(p)
+	if err != nil {
+		return nil, err
+	}
+	handle, err := syscall.CreateFile(
+		name,
+		syscall.GENERIC_READ|syscall.GENERIC_WRITE,
+		0,
+		nil,
+		syscall.OPEN_ALWAYS,
+		syscall.FILE_ATTRIBUTE_NORMAL,
+		0,
+	)
+	if err != nil {
+		if err == errorSharingViolation {
+			return nil, errLocked
+		}
+		return nil, err
+	}
+	return os.NewFile(uintptr(handle), p), nil
+}
+
+func unlockFile(file *os.File) {
+	_ = file.Close()
 }
 
 func newHttpUnixClient(address string) *api {
-	dialer := func(network, addr string) (net.Conn, error) {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
+	dialer := func(ctx context.Context, network, addr string) (net.Conn, error) {
 		return winio.DialPipeContext(ctx, address)
 	}
 	return &api{
 		client: &http.Client{
 			Transport: &http.Transport{
-				Dial: dialer,
+				DialContext: dialer,
 			},
 		},
 	}